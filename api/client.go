@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-querystring/query"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Signer 给GetSigned的参数签名，由live_room实现WBI签名
+type Signer interface {
+	// Sign 返回编码好的query
+	Sign(ctx context.Context, params url.Values) (string, error)
+	// Reset 签名被服务器拒绝，丢弃缓存的key
+	Reset()
+}
+
+// Client 所有HTTP接口共用的客户端，统一处理超时、返回码和签名
+type Client struct {
+	HTTP     *http.Client
+	BaseURLs BaseURLs
+	// Signer 为nil时GetSigned不签名
+	Signer Signer
+	// Timeout 单个请求的超时时间，为0时只受ctx控制
+	Timeout time.Duration
+	// RateLimit 同一类接口每秒最多发出的请求数，为0时不限速
+	RateLimit float64
+	Burst     int
+	// MaxRetries GET请求失败后最多重试几次，RetryBackoff为第一次重试前等待的时间
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Logf 每次重试前记录url和错误，为nil时不记录
+	Logf func(format string, args ...interface{})
+
+	limitMu  sync.Mutex
+	limiters map[string]*limiter
+}
+
+func NewClient(httpClient *http.Client, urls BaseURLs) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &Client{
+		HTTP:         httpClient,
+		BaseURLs:     urls.WithDefault(),
+		Timeout:      defaultTimeout,
+		RateLimit:    defaultRateLimit,
+		Burst:        defaultBurst,
+		MaxRetries:   defaultRetries,
+		RetryBackoff: defaultBackoff,
+	}
+}
+
+// Get params用go-querystring编码到url上，返回的json解析到out，
+// code不为0时返回*APIError，此时out也已经解析好了
+func (c *Client) Get(ctx context.Context, rawURL string, params interface{}, out interface{}) error {
+	if params != nil {
+		v, err := query.Values(params)
+		if err != nil {
+			return err
+		}
+		rawURL = fmt.Sprintf("%s?%s", rawURL, v.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	return c.Do(req, out)
+}
+
+// GetSigned 和Get一样，但是参数由Signer签名，签名被拒绝时刷新key重试一次
+func (c *Client) GetSigned(ctx context.Context, rawURL string, params interface{}, out interface{}) (err error) {
+	v, err := query.Values(params)
+	if err != nil {
+		return
+	}
+	for retry := 0; ; retry++ {
+		q := v.Encode()
+		if c.Signer != nil {
+			if q, err = c.Signer.Sign(ctx, v); err != nil {
+				return
+			}
+		}
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s?%s", rawURL, q), nil); err != nil {
+			return
+		}
+		err = c.Do(req, out)
+		if retry == 0 && c.Signer != nil && IsCode(err, CodeRiskControl) {
+			c.Signer.Reset()
+			continue
+		}
+		return
+	}
+}
+
+func (c *Client) Post(ctx context.Context, rawURL string, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req, out)
+}
+
+func (c *Client) PostForm(ctx context.Context, rawURL string, form url.Values, out interface{}) error {
+	return c.Post(ctx, rawURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), out)
+}
+
+// Do 发送请求并检查返回码，out为nil时只检查返回码
+func (c *Client) Do(req *http.Request, out interface{}) error {
+	_, err := c.DoResponse(req, out)
+	return err
+}
+
+// DoResponse 和Do一样，需要响应头（比如登录后的Set-Cookie）时使用，返回时body已经读完关闭。
+// 请求按接口分类限速，GET请求遇到网络错误、服务器繁忙或者请求过快时退避重试
+func (c *Client) DoResponse(req *http.Request, out interface{}) (resp *http.Response, err error) {
+	l := c.limiter(family(req.URL))
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	for attempt := 0; ; attempt++ {
+		if err = l.wait(req.Context()); err != nil {
+			return
+		}
+		resp, err = c.send(req, out)
+		if err == nil || req.Context().Err() != nil {
+			return
+		}
+		delay := backoff(c.backoffBase(), attempt)
+		if throttled(err) {
+			// 请求过快时整类接口一起等待，服务器给了Retry-After时按它来
+			if resp != nil {
+				if after := retryAfter(resp.Header); after > delay {
+					delay = after
+				}
+			}
+			l.pause(delay)
+		}
+		if !idempotent || attempt >= c.MaxRetries || !temporary(err) {
+			return
+		}
+		l.addRetry()
+		if c.Logf != nil {
+			c.Logf("request failed, retry after %v, attempt=%d, url=%s, err=%v", delay, attempt+1, req.URL, err)
+		}
+		if err = sleep(req.Context(), delay); err != nil {
+			return
+		}
+	}
+}
+
+// send 发出一次请求，HTTP状态码异常时返回Code为负状态码的APIError
+func (c *Client) send(req *http.Request, out interface{}) (resp *http.Response, err error) {
+	if c.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), c.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err = c.HTTP.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	var head struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Msg     string `json:"msg"`
+	}
+	if err = json.Unmarshal(body, &head); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			err = &APIError{Code: -resp.StatusCode, Message: resp.Status}
+			return
+		}
+		err = fmt.Errorf("decode response failed, status=%s, err=%w", resp.Status, err)
+		return
+	}
+	if out != nil {
+		if err = json.Unmarshal(body, out); err != nil {
+			return
+		}
+	}
+	if head.Code != 0 {
+		if head.Message == "" {
+			head.Message = head.Msg
+		}
+		err = &APIError{Code: head.Code, Message: head.Message}
+	}
+	return
+}
+
+func (c *Client) backoffBase() time.Duration {
+	if c.RetryBackoff > 0 {
+		return c.RetryBackoff
+	}
+	return defaultBackoff
+}
+
+func (c *Client) limiter(family string) *limiter {
+	c.limitMu.Lock()
+	defer c.limitMu.Unlock()
+	if c.limiters == nil {
+		c.limiters = make(map[string]*limiter)
+	}
+	l, ok := c.limiters[family]
+	if !ok {
+		l = newLimiter(c.RateLimit, c.Burst)
+		c.limiters[family] = l
+	}
+	return l
+}
+
+// family 接口按host和路径前两段分类，比如/xlive/web-room下的接口共用一个限速器
+func family(u *url.URL) string {
+	segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 3)
+	if len(segments) > 2 {
+		segments = segments[:2]
+	}
+	return u.Host + "/" + strings.Join(segments, "/")
+}
+
+// Stats 每类接口的请求统计，key为host加路径前缀，界面定期记录到日志并在状态栏显示
+func (c *Client) Stats() map[string]LimiterStats {
+	c.limitMu.Lock()
+	defer c.limitMu.Unlock()
+	stats := make(map[string]LimiterStats, len(c.limiters))
+	for family, l := range c.limiters {
+		stats[family] = l.snapshot()
+	}
+	return stats
+}
+
+// throttled 服务器认为请求过快
+func throttled(err error) bool {
+	return IsCode(err, CodeRequestBlocked) || IsCode(err, CodeTooManyRequests) || IsCode(err, CodeTooFrequent)
+}
+
+// temporary 重试可能成功的错误：网络错误、服务器繁忙和请求过快
+func temporary(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	}
+	return throttled(err) || apiErr.Code <= -http.StatusInternalServerError
+}
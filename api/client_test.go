@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (client *Client, server *httptest.Server) {
+	t.Helper()
+	server = httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client = NewClient(server.Client(), BaseURLs{Live: server.URL})
+	client.RetryBackoff = 10 * time.Millisecond
+	return
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls int32
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Write([]byte(`{"code":0}`))
+	})
+	start := time.Now()
+	if err := client.Get(context.Background(), server.URL+"/room/v1/Room/get_info", nil, nil); err != nil {
+		t.Fatalf("get failed, err=%v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retry before Retry-After, elapsed=%v", elapsed)
+	}
+	if calls != 2 {
+		t.Errorf("calls=%d, want 2", calls)
+	}
+	stats := client.Stats()[family(mustParse(t, server.URL+"/room/v1/x"))]
+	if stats.Retries != 1 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRetryCode(t *testing.T) {
+	var calls int32
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.Write([]byte(`{"code":-509,"message":"请求过于频繁"}`))
+			return
+		}
+		w.Write([]byte(`{"code":0}`))
+	})
+	var logged int
+	client.Logf = func(format string, args ...interface{}) { logged++ }
+	if err := client.Get(context.Background(), server.URL+"/room/v1/Room/get_info", nil, nil); err != nil {
+		t.Fatalf("get failed, err=%v", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls=%d, want 3", calls)
+	}
+	if logged != 2 {
+		t.Errorf("logged=%d, want 2", logged)
+	}
+
+	// 超过重试次数返回最后一次的错误
+	atomic.StoreInt32(&calls, 0)
+	client.MaxRetries = 1
+	err := client.Get(context.Background(), server.URL+"/room/v1/Room/get_info", nil, nil)
+	if !IsCode(err, CodeTooFrequent) {
+		t.Errorf("err=%v, want code %d", err, CodeTooFrequent)
+	}
+}
+
+func TestPostNotRetried(t *testing.T) {
+	var calls int32
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	err := client.PostForm(context.Background(), server.URL+"/msg/send", nil, nil)
+	if !IsCode(err, -http.StatusServiceUnavailable) {
+		t.Errorf("err=%v, want code %d", err, -http.StatusServiceUnavailable)
+	}
+	if calls != 1 {
+		t.Errorf("calls=%d, want 1", calls)
+	}
+}
+
+func TestNotTemporary(t *testing.T) {
+	var calls int32
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"code":-101,"message":"账号未登录"}`))
+	})
+	err := client.Get(context.Background(), server.URL+"/x/web-interface/nav", nil, nil)
+	if !IsCode(err, CodeNotLogin) {
+		t.Errorf("err=%v, want code %d", err, CodeNotLogin)
+	}
+	if calls != 1 {
+		t.Errorf("calls=%d, want 1", calls)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0}`))
+	})
+	client.RateLimit = 20
+	client.Burst = 2
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := client.Get(context.Background(), server.URL+"/room/v1/Room/get_info", nil, nil); err != nil {
+			t.Fatalf("get failed, err=%v", err)
+		}
+	}
+	// 前两个用掉突发额度，后两个各等50ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("requests not throttled, elapsed=%v", elapsed)
+	}
+	// 其他类的接口不受影响
+	if err := client.Get(context.Background(), server.URL+"/xlive/web-room/v1/index/getDanmuInfo", nil, nil); err != nil {
+		t.Fatalf("get failed, err=%v", err)
+	}
+	stats := client.Stats()
+	room := stats[family(mustParse(t, server.URL+"/room/v1/x"))]
+	if room.Requests != 4 || room.Throttled != 2 || room.WaitTime <= 0 {
+		t.Errorf("unexpected room stats %+v", room)
+	}
+	danmu := stats[family(mustParse(t, server.URL+"/xlive/web-room/x"))]
+	if danmu.Requests != 1 || danmu.Throttled != 0 {
+		t.Errorf("unexpected danmu stats %+v", danmu)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.Get(ctx, server.URL+"/room/v1/Room/get_info", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err=%v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancel not respected, elapsed=%v", elapsed)
+	}
+}
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
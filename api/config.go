@@ -1,13 +1,29 @@
 package api
 
 type BiliLiveConfig struct {
-	RoomID         uint64 `toml:"room_id"`
-	ChatBuffer     int    `toml:"chat_buffer"`
-	ShowShipLevel  bool   `toml:"show_ship_level"`
-	ShowMedalName  bool   `toml:"show_medal_name"`
-	ShowMedalLevel bool   `toml:"show_medal_level"`
-	ColorMode      bool   `toml:"color_mode"`
-	ShowRoomTitle  bool   `toml:"show_room_title"`
-	ShowRoomNumber bool   `toml:"show_room_number"`
-	UserAgent      string `toml:"user_agent"`
+	RoomID             uint64         `toml:"room_id"`
+	ChatBuffer         int            `toml:"chat_buffer"`
+	ShowShipLevel      bool           `toml:"show_ship_level"`
+	ShowMedalName      bool           `toml:"show_medal_name"`
+	ShowMedalLevel     bool           `toml:"show_medal_level"`
+	ColorMode          bool           `toml:"color_mode"`
+	ShowRoomTitle      bool           `toml:"show_room_title"`
+	ShowRoomNumber     bool           `toml:"show_room_number"`
+	UserAgent          string         `toml:"user_agent"`
+	Proxy              string         `toml:"proxy"`
+	NoProxy            []string       `toml:"no_proxy"`
+	DanmuTransport     DanmuTransport `toml:"danmu_transport"`
+	ProtoVer           *DanmuProtol   `toml:"protover"`
+	MaxReconnect       int            `toml:"max_reconnect"`
+	HeartBeatInterval  int            `toml:"heartbeat_interval"`
+	HeartBeatMaxMissed int            `toml:"heartbeat_max_missed"`
+	Record             bool           `toml:"record"`
+	RecordFile         string         `toml:"record_file"`
+	RecordMaxSize      int            `toml:"record_max_size"`
+	RecordRotateOnLive bool           `toml:"record_rotate_on_live"`
+	QueueSize          int            `toml:"queue_size"`
+	QueuePolicy        QueuePolicy    `toml:"queue_policy"`
+	SplitLongDanmu     bool           `toml:"split_long_danmu"`
+	ShowGift           bool           `toml:"show_gift"`
+	BaseURLs           BaseURLs       `toml:"base_urls"`
 }
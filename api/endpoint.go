@@ -0,0 +1,37 @@
+package api
+
+type BaseURLs struct {
+	Live      string `toml:"live"`
+	Main      string `toml:"main"`
+	Passport  string `toml:"passport"`
+	Account   string `toml:"account"`
+	LiveTrace string `toml:"live_trace"`
+}
+
+var DefaultBaseURLs = BaseURLs{
+	Live:      "https://api.live.bilibili.com",
+	Main:      "https://api.bilibili.com",
+	Passport:  "https://passport.bilibili.com",
+	Account:   "https://account.bilibili.com",
+	LiveTrace: "https://live-trace.bilibili.com",
+}
+
+// WithDefault 没有配置的地址使用默认值
+func (b BaseURLs) WithDefault() BaseURLs {
+	if b.Live == "" {
+		b.Live = DefaultBaseURLs.Live
+	}
+	if b.Main == "" {
+		b.Main = DefaultBaseURLs.Main
+	}
+	if b.Passport == "" {
+		b.Passport = DefaultBaseURLs.Passport
+	}
+	if b.Account == "" {
+		b.Account = DefaultBaseURLs.Account
+	}
+	if b.LiveTrace == "" {
+		b.LiveTrace = DefaultBaseURLs.LiveTrace
+	}
+	return b
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 接口常见的返回码，HTTP状态码异常时用负的状态码表示
+const (
+	CodeNotLogin        = -101
+	CodeCSRFFailed      = -111
+	CodeRiskControl     = -352
+	CodeRequestBlocked  = -412
+	CodeTooManyRequests = -429
+	CodeTooFrequent     = -509
+)
+
+// 发送弹幕的返回码，其余的错误（比如粉丝勋章等级不够）直接看Message
+const (
+	CodeDanmuInvalid   = -400
+	CodeDanmuMuted     = 1003
+	CodeDanmuTooFast   = 10030
+	CodeDanmuDuplicate = 10031
+)
+
+// APIError 接口返回的code不为0，或者HTTP状态码异常
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.Code, e.Message)
+}
+
+// IsCode err是否为指定返回码的APIError
+func IsCode(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
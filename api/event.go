@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	CmdDanmuMsg                  = "DANMU_MSG"
+	CmdSendGift                  = "SEND_GIFT"
+	CmdComboSend                 = "COMBO_SEND"
+	CmdSuperChatMessage          = "SUPER_CHAT_MESSAGE"
+	CmdSuperChatMessageDelete    = "SUPER_CHAT_MESSAGE_DELETE"
+	CmdGuardBuy                  = "GUARD_BUY"
+	CmdInteractWord              = "INTERACT_WORD"
+	CmdEntryEffect               = "ENTRY_EFFECT"
+	CmdWatchedChange             = "WATCHED_CHANGE"
+	CmdOnlineRankCount           = "ONLINE_RANK_COUNT"
+	CmdLikeInfoV3Update          = "LIKE_INFO_V3_UPDATE"
+	CmdRoomChange                = "ROOM_CHANGE"
+	CmdRoomRealTimeMessageUpdate = "ROOM_REAL_TIME_MESSAGE_UPDATE"
+	CmdRoomBlockMsg              = "ROOM_BLOCK_MSG"
+	CmdLive                      = "LIVE"
+	CmdPreparing                 = "PREPARING"
+	CmdWarning                   = "WARNING"
+	CmdCutOff                    = "CUT_OFF"
+)
+
+// Event 解码后的直播间消息
+type Event interface {
+	EventCmd() string
+}
+
+// FlexInt 有些字段时而是数字时而是字符串，比如PREPARING里的roomid
+type FlexInt int64
+
+func (n *FlexInt) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = FlexInt(v)
+	return nil
+}
+
+type MedalInfo struct {
+	Level     uint8
+	Name      string
+	Color     int64
+	ShipLevel uint8
+}
+
+// DanmuMsgEvent DANMU_MSG的info是一个按位置排列的数组，由解码器逐个字段检查后填充
+type DanmuMsgEvent struct {
+	UID          uint64
+	UName        string
+	Content      string
+	SendTime     time.Time
+	ContentColor int64
+	Mode         int
+	NameColor    string
+	Medal        *MedalInfo
+	Extra        string
+	// DmID 弹幕的id，回复弹幕时需要
+	DmID string
+	// ReplyMid 回复的用户，为0时不是回复
+	ReplyMid   uint64
+	ReplyUName string
+}
+
+func (e *DanmuMsgEvent) EventCmd() string { return CmdDanmuMsg }
+
+type SendGiftEvent struct {
+	UID       uint64 `json:"uid"`
+	UName     string `json:"uname"`
+	Action    string `json:"action"`
+	GiftID    int64  `json:"giftId"`
+	GiftName  string `json:"giftName"`
+	Num       int    `json:"num"`
+	Price     int64  `json:"price"`
+	CoinType  string `json:"coin_type"`
+	TotalCoin int64  `json:"total_coin"`
+	Timestamp int64  `json:"timestamp"`
+	BatchID   string `json:"batch_combo_id"`
+}
+
+func (e *SendGiftEvent) EventCmd() string { return CmdSendGift }
+
+type ComboSendEvent struct {
+	UID        uint64 `json:"uid"`
+	UName      string `json:"uname"`
+	Action     string `json:"action"`
+	GiftID     int64  `json:"gift_id"`
+	GiftName   string `json:"gift_name"`
+	ComboNum   int    `json:"combo_num"`
+	TotalNum   int    `json:"total_num"`
+	ComboTotal int64  `json:"combo_total_coin"`
+}
+
+func (e *ComboSendEvent) EventCmd() string { return CmdComboSend }
+
+type SuperChatEvent struct {
+	ID              FlexInt `json:"id"`
+	UID             uint64  `json:"uid"`
+	Price           int     `json:"price"`
+	Message         string  `json:"message"`
+	Time            int     `json:"time"`
+	StartTime       int64   `json:"start_time"`
+	EndTime         int64   `json:"end_time"`
+	BackgroundColor string  `json:"background_color"`
+	UserInfo        SCUser  `json:"user_info"`
+	MedalInfo       SCMedal `json:"medal_info"`
+}
+
+type SCUser struct {
+	UName     string `json:"uname"`
+	NameColor string `json:"name_color"`
+	Face      string `json:"face"`
+}
+
+type SCMedal struct {
+	MedalName  string `json:"medal_name"`
+	MedalLevel int    `json:"medal_level"`
+	GuardLevel int    `json:"guard_level"`
+}
+
+func (e *SuperChatEvent) EventCmd() string { return CmdSuperChatMessage }
+
+type SuperChatDeleteEvent struct {
+	IDs []int64 `json:"ids"`
+}
+
+func (e *SuperChatDeleteEvent) EventCmd() string { return CmdSuperChatMessageDelete }
+
+type GuardBuyEvent struct {
+	UID        uint64 `json:"uid"`
+	UName      string `json:"username"`
+	GuardLevel uint8  `json:"guard_level"`
+	Num        int    `json:"num"`
+	Price      int64  `json:"price"`
+	GiftID     int64  `json:"gift_id"`
+	GiftName   string `json:"gift_name"`
+	StartTime  int64  `json:"start_time"`
+}
+
+func (e *GuardBuyEvent) EventCmd() string { return CmdGuardBuy }
+
+type InteractType int
+
+const (
+	InteractEnter InteractType = iota + 1
+	InteractFollow
+	InteractShare
+	InteractSpecialFollow
+	InteractMutualFollow
+)
+
+type InteractWordEvent struct {
+	UID       uint64       `json:"uid"`
+	UName     string       `json:"uname"`
+	MsgType   InteractType `json:"msg_type"`
+	RoomID    uint64       `json:"roomid"`
+	Timestamp int64        `json:"timestamp"`
+	FansMedal struct {
+		MedalName  string `json:"medal_name"`
+		MedalLevel int    `json:"medal_level"`
+		GuardLevel int    `json:"guard_level"`
+	} `json:"fans_medal"`
+}
+
+func (e *InteractWordEvent) EventCmd() string { return CmdInteractWord }
+
+type EntryEffectEvent struct {
+	ID            int64  `json:"id"`
+	UID           uint64 `json:"uid"`
+	TargetID      uint64 `json:"target_id"`
+	PrivilegeType int    `json:"privilege_type"`
+	CopyWriting   string `json:"copy_writing"`
+}
+
+func (e *EntryEffectEvent) EventCmd() string { return CmdEntryEffect }
+
+type WatchedChangeEvent struct {
+	Num       int64  `json:"num"`
+	TextSmall string `json:"text_small"`
+	TextLarge string `json:"text_large"`
+}
+
+func (e *WatchedChangeEvent) EventCmd() string { return CmdWatchedChange }
+
+type OnlineRankCountEvent struct {
+	Count int64 `json:"count"`
+}
+
+func (e *OnlineRankCountEvent) EventCmd() string { return CmdOnlineRankCount }
+
+type LikeInfoUpdateEvent struct {
+	ClickCount int64 `json:"click_count"`
+}
+
+func (e *LikeInfoUpdateEvent) EventCmd() string { return CmdLikeInfoV3Update }
+
+type RoomChangeEvent struct {
+	Title          string `json:"title"`
+	AreaID         int    `json:"area_id"`
+	AreaName       string `json:"area_name"`
+	ParentAreaID   int    `json:"parent_area_id"`
+	ParentAreaName string `json:"parent_area_name"`
+}
+
+func (e *RoomChangeEvent) EventCmd() string { return CmdRoomChange }
+
+type RoomRealTimeMessageUpdateEvent struct {
+	RoomID    uint64 `json:"roomid"`
+	Fans      int64  `json:"fans"`
+	FansClub  int64  `json:"fans_club"`
+	RedNotice int    `json:"red_notice"`
+}
+
+func (e *RoomRealTimeMessageUpdateEvent) EventCmd() string { return CmdRoomRealTimeMessageUpdate }
+
+type RoomBlockMsgEvent struct {
+	UID      FlexInt `json:"uid"`
+	UName    string  `json:"uname"`
+	Operator int     `json:"operator"`
+}
+
+func (e *RoomBlockMsgEvent) EventCmd() string { return CmdRoomBlockMsg }
+
+// 下面几个消息的字段在顶层而不是data里
+
+type LiveEvent struct {
+	RoomID       FlexInt `json:"roomid"`
+	LiveTime     int64   `json:"live_time"`
+	LivePlatform string  `json:"live_platform"`
+}
+
+func (e *LiveEvent) EventCmd() string { return CmdLive }
+
+type PreparingEvent struct {
+	RoomID FlexInt `json:"roomid"`
+}
+
+func (e *PreparingEvent) EventCmd() string { return CmdPreparing }
+
+type WarningEvent struct {
+	Msg    string  `json:"msg"`
+	RoomID FlexInt `json:"roomid"`
+}
+
+func (e *WarningEvent) EventCmd() string { return CmdWarning }
+
+type CutOffEvent struct {
+	Msg    string  `json:"msg"`
+	RoomID FlexInt `json:"roomid"`
+}
+
+func (e *CutOffEvent) EventCmd() string { return CmdCutOff }
+
+// UnknownEvent 还没有对应类型的消息，保留原始json
+type UnknownEvent struct {
+	Cmd string
+	Raw json.RawMessage
+}
+
+func (e *UnknownEvent) EventCmd() string { return e.Cmd }
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+var roomNotStartedErr = errors.New("live room not started")
+
+// Start 开始房间的生命周期，ctx取消或者调用Close时房间关闭，
+// 所有通过Go启动的协程退出后关闭MessageChan和Recorder
+func (room *LiveRoom) Start(ctx context.Context) {
+	room.ctx, room.cancel = context.WithCancel(ctx)
+	room.DoneChan = room.ctx.Done()
+	room.exited = make(chan struct{})
+	go func() {
+		<-room.ctx.Done()
+		room.mu.Lock()
+		room.closing = true
+		room.mu.Unlock()
+		room.wg.Wait()
+		if room.MessageChan != nil {
+			close(room.MessageChan)
+		}
+		if room.Recorder != nil {
+			room.closeErr = room.Recorder.Close()
+		}
+		close(room.exited)
+	}()
+}
+
+// Go 在房间的生命周期内启动协程，房间已经关闭时不启动并返回false
+func (room *LiveRoom) Go(f func()) bool {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.closing {
+		return false
+	}
+	room.wg.Add(1)
+	go func() {
+		defer room.wg.Done()
+		f()
+	}()
+	return true
+}
+
+func (room *LiveRoom) Context() context.Context {
+	if room.ctx == nil {
+		return context.Background()
+	}
+	return room.ctx
+}
+
+// Cancel 通知房间关闭但不等待，可以在房间自己的协程里调用
+func (room *LiveRoom) Cancel() {
+	if room.cancel != nil {
+		room.cancel()
+	}
+}
+
+// Close 关闭房间并等待所有协程退出，可以重复调用
+func (room *LiveRoom) Close() error {
+	if room.cancel == nil {
+		return roomNotStartedErr
+	}
+	room.cancel()
+	return room.Wait()
+}
+
+// Wait 等待房间关闭，包括ctx被取消和重连失败放弃的情况
+func (room *LiveRoom) Wait() error {
+	if room.exited == nil {
+		return roomNotStartedErr
+	}
+	<-room.exited
+	return room.closeErr
+}
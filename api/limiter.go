@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimit 同一类接口每秒最多发出的请求数
+	defaultRateLimit = 5
+	defaultBurst     = 5
+	defaultRetries   = 2
+	defaultBackoff   = 500 * time.Millisecond
+	maxBackoff       = 10 * time.Second
+)
+
+// LimiterStats 一类接口的请求统计
+type LimiterStats struct {
+	Requests uint64
+	// Throttled 因为限速或者服务器要求等待而推迟发出的请求数
+	Throttled uint64
+	WaitTime  time.Duration
+	Retries   uint64
+	// Rejected 被服务器以请求过快拒绝的次数
+	Rejected uint64
+}
+
+// limiter 令牌桶，同一类接口共用，服务器要求等待时整类接口一起暂停
+type limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	stats       LimiterStats
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve 取一个令牌，返回还需要等待多久才能发出请求
+func (l *limiter) reserve() (delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.stats.Requests++
+	if l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		l.tokens--
+		if l.tokens < 0 {
+			delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	if paused := l.pausedUntil.Sub(now); paused > delay {
+		delay = paused
+	}
+	if delay > 0 {
+		l.stats.Throttled++
+		l.stats.WaitTime += delay
+	}
+	return
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	return sleep(ctx, delay)
+}
+
+// pause 服务器拒绝请求后，d时间内这类接口都不再发出请求
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Rejected++
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *limiter) addRetry() {
+	l.mu.Lock()
+	l.stats.Retries++
+	l.mu.Unlock()
+}
+
+func (l *limiter) snapshot() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff 第attempt次重试前等待的时间，指数增长并加上随机抖动
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter 解析Retry-After，支持秒数和HTTP时间两种格式
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
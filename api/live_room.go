@@ -1,26 +1,104 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"net"
-	"net/http"
+	"sync"
+	"time"
 )
 
 type LiveRoom struct {
-	UID          uint64
-	RoomID       uint64
-	Hot          uint32
-	Seq          uint32
-	MessageChan  chan *DanmuMessage
-	ReqChan      chan []byte
-	DoneChan     chan struct{}
-	RetryChan    chan struct{}
-	StreamConn   net.Conn
-	Title        string
-	ShortID      uint64
-	OwnerId      uint64
-	RoomUserInfo *UserRoomProperty
-	Client       *http.Client
-	CSRF         string
+	UID             uint64
+	Buvid           string
+	RoomID          uint64
+	Hot             uint32
+	Seq             uint32
+	MessageChan     chan *DanmuMessage
+	ReqChan         chan []byte
+	DoneChan        <-chan struct{}
+	RetryChan       chan struct{}
+	StatusChan      chan *ConnStatus
+	StreamConn      net.Conn
+	Title           string
+	ShortID         uint64
+	OwnerId         uint64
+	RoomUserInfo    *UserRoomProperty
+	IsAdmin         bool
+	Client          *Client
+	CSRF            string
+	Config          *BiliLiveConfig
+	HeartBeatRespAt int64
+	HeartBeatSentAt int64
+	DanmuHost       string
+	Recorder        MessageRecorder
+	Queue           MessageQueue
+	Bus             MessageBus
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	closing  bool
+	exited   chan struct{}
+	closeErr error
+}
+
+type MessageRecorder interface {
+	RecordRaw(data []byte)
+	RecordMessage(cmd string, data []byte)
+	Rotate()
+	Close() error
+}
+
+// MessageQueue 读循环和MessageChan之间的有界队列，Push不会阻塞
+type MessageQueue interface {
+	Push(msg *DanmuMessage)
+	Dropped() uint64
+}
+
+// MessageBus 把MessageChan里的消息分发给多个订阅者，通过live_room.Subscribe订阅
+type MessageBus interface {
+	Close()
+}
+
+type ConnState uint8
+
+const (
+	// ConnConnecting 正在连接和认证
+	ConnConnecting ConnState = iota
+	// ConnConnected 认证成功，心跳回复时也会带着延迟再发一次
+	ConnConnected
+	// ConnDisconnected 连接断开，马上开始重连
+	ConnDisconnected
+	// ConnReconnecting 等待下一次重连
+	ConnReconnecting
+	// ConnClosed 放弃重连或者房间已关闭
+	ConnClosed
+)
+
+var connStateNames = map[ConnState]string{
+	ConnConnecting:   "连接中",
+	ConnConnected:    "已连接",
+	ConnDisconnected: "已断开",
+	ConnReconnecting: "重连中",
+	ConnClosed:       "已关闭",
+}
+
+func (s ConnState) String() string {
+	return connStateNames[s]
+}
+
+// ConnStatus 弹幕连接的状态变化
+type ConnStatus struct {
+	State      ConnState
+	Time       time.Time
+	Attempt    int
+	MaxAttempt int
+	Host       string
+	Delay      time.Duration
+	RTT        time.Duration
+	Err        error
 }
 
 type DanmuInfoReq struct {
@@ -32,21 +110,41 @@ type DanmuInfoResp struct {
 	Message string `json:"message"`
 	Ttl     int    `json:"ttl"`
 	Data    struct {
-		Group            string  `json:"group"`
-		BusinessId       int     `json:"business_id"`
-		RefreshRowFactor float64 `json:"refresh_row_factor"`
-		RefreshRate      int     `json:"refresh_rate"`
-		MaxDelay         int     `json:"max_delay"`
-		Token            string  `json:"token"`
-		HostList         []struct {
-			Host    string `json:"host"`
-			Port    int    `json:"port"`
-			WssPort int    `json:"wss_port"`
-			WsPort  int    `json:"ws_port"`
-		} `json:"host_list"`
+		Group            string      `json:"group"`
+		BusinessId       int         `json:"business_id"`
+		RefreshRowFactor float64     `json:"refresh_row_factor"`
+		RefreshRate      int         `json:"refresh_rate"`
+		MaxDelay         int         `json:"max_delay"`
+		Token            string      `json:"token"`
+		HostList         []DanmuHost `json:"host_list"`
 	} `json:"data"`
 }
 
+type DanmuHost struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	WssPort int    `json:"wss_port"`
+	WsPort  int    `json:"ws_port"`
+}
+
+type DanmuTransport string
+
+const (
+	DanmuTransportAuto DanmuTransport = "auto"
+	DanmuTransportTCP  DanmuTransport = "tcp"
+	DanmuTransportWSS  DanmuTransport = "wss"
+	DanmuTransportWS   DanmuTransport = "ws"
+)
+
+type QueuePolicy string
+
+const (
+	// QueueDropOldest 队列满时丢弃最早的消息
+	QueueDropOldest QueuePolicy = "drop_oldest"
+	// QueueSample 队列过半时对进场等低优先级消息抽样
+	QueueSample QueuePolicy = "sample"
+)
+
 type RoomInfoReq struct {
 	RoomID uint64 `url:"room_id"`
 }
@@ -133,6 +231,7 @@ type DanmuAuthPacketReq struct {
 	UID      uint64 `json:"uid"`
 	RoomID   uint64 `json:"roomid"`
 	ProtoVer uint8  `json:"protover"`
+	Buvid    string `json:"buvid,omitempty"`
 	Platform string `json:"platform"`
 	Type     uint8  `json:"type"`
 	Key      string `json:"key"`
@@ -174,6 +273,7 @@ type DanmuMessage struct {
 	Info  []interface{}          `json:"info"`
 	Data  map[string]interface{} `json:"data"`
 	Other map[string]interface{} `json:"-"`
+	Raw   json.RawMessage        `json:"-"`
 }
 
 type QRCodeGenerateResp struct {
@@ -214,22 +314,42 @@ type PollLoginResp struct {
 	} `json:"data"`
 }
 
+// BuvidResp 游客的设备标识，b_3和b_4分别对应cookie里的buvid3和buvid4
+type BuvidResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		B3 string `json:"b_3"`
+		B4 string `json:"b_4"`
+	} `json:"data"`
+}
+
 type UserInfo struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Ttl     int    `json:"ttl"`
 	Data    struct {
-		Mid   uint64 `json:"mid"`
-		Uname string `json:"uname"`
+		Mid    uint64 `json:"mid"`
+		Uname  string `json:"uname"`
+		WbiImg WbiImg `json:"wbi_img"`
 	} `json:"data"`
 }
 
+// WbiImg 计算WBI签名用的两个key藏在图片地址的文件名里，未登录时也会返回
+type WbiImg struct {
+	ImgURL string `json:"img_url"`
+	SubURL string `json:"sub_url"`
+}
+
 type UserRoomInfo struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Ttl     int    `json:"ttl"`
 	Data    struct {
 		Property UserRoomProperty `json:"property"`
+		Badge    struct {
+			IsRoomAdmin bool `json:"is_room_admin"`
+		} `json:"badge"`
 	} `json:"data"`
 }
 
@@ -255,4 +375,225 @@ type SendMsgReq struct {
 	RoomID    uint64 `url:"roomid"`
 	CSRF      string `url:"csrf"`
 	CSRFToken string `url:"csrf_token"`
+	// DmType 1为表情弹幕，此时Msg为表情的EmoticonUnique
+	DmType int `url:"dm_type,omitempty"`
+	// ReplyMid 回复的用户，ReplyDmid是被回复的弹幕id，接口的字段名就是replay
+	ReplyMid  uint64 `url:"reply_mid,omitempty"`
+	ReplyDmid string `url:"replay_dmid,omitempty"`
+}
+
+const DmTypeEmoticon = 1
+
+// SendMsgResp 发送弹幕的返回，code为0但message为f或k时弹幕被屏蔽词拦截，实际没有发出去
+type SendMsgResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Msg     string `json:"msg"`
+}
+
+type EmoticonReq struct {
+	Platform string `url:"platform"`
+	RoomID   uint64 `url:"room_id"`
+}
+
+type EmoticonResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Data []EmoticonPackage `json:"data"`
+	} `json:"data"`
+}
+
+// EmoticonPackage 一组表情，包括通用表情、房间专属表情和粉丝勋章表情等
+type EmoticonPackage struct {
+	PkgID     int        `json:"pkg_id"`
+	PkgName   string     `json:"pkg_name"`
+	PkgType   int        `json:"pkg_type"`
+	Emoticons []Emoticon `json:"emoticons"`
+}
+
+type Emoticon struct {
+	Emoji          string `json:"emoji"`
+	Descript       string `json:"descript"`
+	URL            string `json:"url"`
+	EmoticonUnique string `json:"emoticon_unique"`
+	// Perm 为0时当前用户还不能使用，比如粉丝勋章等级不够
+	Perm           int    `json:"perm"`
+	UnlockShowText string `json:"unlock_show_text"`
+}
+
+const (
+	CoinTypeGold   = "gold"
+	CoinTypeSilver = "silver"
+)
+
+type GiftConfigReq struct {
+	Platform string `url:"platform"`
+	RoomID   uint64 `url:"room_id"`
+}
+
+type GiftConfigResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		List []GiftConfig `json:"list"`
+	} `json:"data"`
+}
+
+// GiftConfig 房间可以赠送的礼物，Price的单位是金瓜子，1000金瓜子等于1元
+type GiftConfig struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Price    int64  `json:"price"`
+	CoinType string `json:"coin_type"`
+}
+
+type BagListReq struct {
+	RoomID uint64 `url:"room_id"`
+	T      int64  `url:"t"`
+}
+
+type BagListResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		List []BagGift `json:"list"`
+	} `json:"data"`
+}
+
+// BagGift 包裹里的免费礼物，ExpireAt为0时不会过期
+type BagGift struct {
+	BagID    int64  `json:"bag_id"`
+	GiftID   int64  `json:"gift_id"`
+	GiftName string `json:"gift_name"`
+	GiftNum  int    `json:"gift_num"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+type WalletReq struct {
+	NeedBp    int    `url:"need_bp"`
+	NeedMetal int    `url:"need_metal"`
+	Platform  string `url:"platform"`
+}
+
+type WalletResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    Wallet `json:"data"`
+}
+
+// Wallet 金瓜子对应电池，100金瓜子为1电池
+type Wallet struct {
+	Gold   int64   `json:"gold"`
+	Silver int64   `json:"silver"`
+	Bp     float64 `json:"bp"`
+}
+
+// SendGiftReq 赠送礼物，BagID不为0时从包裹里送
+type SendGiftReq struct {
+	UID       uint64 `url:"uid"`
+	GiftID    int64  `url:"gift_id"`
+	Ruid      uint64 `url:"ruid"`
+	SendRuid  int    `url:"send_ruid"`
+	GiftNum   int    `url:"gift_num"`
+	CoinType  string `url:"coin_type"`
+	BagID     int64  `url:"bag_id"`
+	Platform  string `url:"platform"`
+	BizCode   string `url:"biz_code"`
+	BizID     uint64 `url:"biz_id"`
+	Price     int64  `url:"price"`
+	Rnd       int64  `url:"rnd"`
+	CSRF      string `url:"csrf"`
+	CSRFToken string `url:"csrf_token"`
+}
+
+// LikeReportReq 点赞，ClickTime为这一批点了多少次
+type LikeReportReq struct {
+	ClickTime int    `url:"click_time"`
+	RoomID    uint64 `url:"room_id"`
+	UID       uint64 `url:"uid"`
+	AnchorID  uint64 `url:"anchor_id"`
+	CSRF      string `url:"csrf"`
+	CSRFToken string `url:"csrf_token"`
+}
+
+// RoomLikeInfoResp getInfoByRoom接口，这里只需要房间的点赞总数
+type RoomLikeInfoResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		LikeInfoV3 struct {
+			TotalLikes int64 `json:"total_likes"`
+		} `json:"like_info_v3"`
+	} `json:"data"`
+}
+
+// 禁言时长，其余的值为小时数
+const (
+	MuteHourThisLive = 0
+	MuteHourForever  = -1
+)
+
+// SilentUserReq 禁言或者解除禁言，解除时不需要Hour
+type SilentUserReq struct {
+	RoomID    uint64 `url:"room_id"`
+	TUID      uint64 `url:"tuid"`
+	MobileApp string `url:"mobile_app,omitempty"`
+	Type      int    `url:"type,omitempty"`
+	Hour      int    `url:"hour"`
+	CSRF      string `url:"csrf"`
+	CSRFToken string `url:"csrf_token"`
+}
+
+type SilentUserListReq struct {
+	RoomID    uint64 `url:"room_id"`
+	Ps        int    `url:"ps"`
+	CSRF      string `url:"csrf"`
+	CSRFToken string `url:"csrf_token"`
+}
+
+type SilentUserListResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Data      []SilentUser `json:"data"`
+		Total     int          `json:"total"`
+		TotalPage int          `json:"total_page"`
+	} `json:"data"`
+}
+
+// SilentUser 被禁言的用户，Name是操作的房管
+type SilentUser struct {
+	TUID         uint64 `json:"tuid"`
+	TName        string `json:"tname"`
+	UID          uint64 `json:"uid"`
+	Name         string `json:"name"`
+	Ctime        string `json:"ctime"`
+	BlockEndTime string `json:"block_end_time"`
+}
+
+type ShieldKeywordReq struct {
+	RoomID    uint64 `url:"room_id"`
+	Keyword   string `url:"keyword"`
+	CSRF      string `url:"csrf"`
+	CSRFToken string `url:"csrf_token"`
+}
+
+type ShieldKeywordListReq struct {
+	RoomID uint64 `url:"room_id"`
+}
+
+type ShieldKeywordListResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		KeywordList []ShieldKeyword `json:"keyword_list"`
+		MaxLimit    int             `json:"max_limit"`
+	} `json:"data"`
+}
+
+type ShieldKeyword struct {
+	Keyword string `json:"keyword"`
+	UID     uint64 `json:"uid"`
+	Name    string `json:"name"`
 }
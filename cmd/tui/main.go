@@ -1,16 +1,53 @@
 package main
 
 import (
+	"context"
+	"flag"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
 	"github.com/shr-go/bili_live_tui/internal/tui"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
 	"os"
+	"time"
 )
 
 func main() {
+	mock := flag.Bool("mock", false, "使用本地模拟服务器，不需要网络")
+	record := flag.Bool("record", false, "把收到的弹幕数据保存到文件")
+	recordFile := flag.String("record-file", "", "弹幕数据保存的文件，默认为record/danmu.rec")
+	replayFile := flag.String("replay", "", "回放录制的弹幕文件，不需要网络")
+	speed := flag.Float64("speed", 1, "回放速度倍数，0为单步回放")
+	step := flag.Bool("step", false, "单步回放，按n播放下一条")
+	flag.Parse()
+
+	if *replayFile != "" {
+		if *step {
+			*speed = 0
+		}
+		replay(*replayFile, *speed)
+		return
+	}
+
+	if *record {
+		tui.LiveConfig.Record = true
+	}
+	if *recordFile != "" {
+		tui.LiveConfig.RecordFile = *recordFile
+	}
+
 	logging.Infof("tui start")
+	if *mock {
+		server, err := mock_server.Start()
+		if err != nil {
+			logging.Fatalf("Start mock server error, err=%v", err)
+		}
+		defer server.Close()
+		server.AutoDanmu(time.Second)
+		tui.EnableMockMode(server.BaseURLs())
+		logging.Infof("mock server started, url=%s", server.URL())
+	}
 	client := tui.GetCustomHttpClient()
-	room, err := tui.PrepareEnterRoom(client)
+	room, err := tui.PrepareEnterRoom(context.Background(), client)
 	if err != nil || room == nil {
 		logging.Fatalf("Connect server error, err=%v", err)
 	}
@@ -21,4 +58,21 @@ func main() {
 		logging.Fatalf("Alas, there's been an error: %v", err)
 		os.Exit(1)
 	}
+	room.Close()
+}
+
+func replay(fileName string, speed float64) {
+	logging.Infof("replay %s, speed=%g", fileName, speed)
+	room, player, err := tui.PrepareReplay(context.Background(), fileName, speed)
+	if err != nil {
+		logging.Fatalf("Load replay file error, err=%v", err)
+	}
+	p := tea.NewProgram(tui.InitialReplayModel(room, player), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	go tui.ReceiveMsg(p, room)
+	go tui.PoolWindowSize(p)
+	go tui.Replay(p, room, player)
+	if err := p.Start(); err != nil {
+		logging.Fatalf("Alas, there's been an error: %v", err)
+	}
+	room.Close()
 }
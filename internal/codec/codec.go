@@ -0,0 +1,99 @@
+// Package codec 弹幕协议的封包和解包，客户端和模拟服务器共用
+package codec
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+
+	"github.com/andybalholm/brotli"
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+const (
+	HeaderSize = 16
+	// MaxFrameSize 超过这个大小的包或者解压后的数据认为已经错乱
+	MaxFrameSize = 16 * 1024 * 1024
+	// maxNestDepth 压缩包里还可以再套压缩包，限制嵌套层数
+	maxNestDepth = 4
+)
+
+var (
+	HeaderNotCompleteErr = errors.New("header not complete")
+	InvalidHeaderErr     = errors.New("message invalid")
+	FrameTooLargeErr     = errors.New("frame too large")
+	NestTooDeepErr       = errors.New("compressed batch nested too deep")
+)
+
+// Supported 认证时可以选择的协议版本
+func Supported(protoVer api.DanmuProtol) bool {
+	switch protoVer {
+	case api.DanmuProtolNormal, api.DanmuProtolNormalZlib, api.DanmuProtolNormalBrotli:
+		return true
+	}
+	return false
+}
+
+// DecodeHeader 直接按偏移读取头部字段
+func DecodeHeader(data []byte) (header api.DanmuMessageHeader, err error) {
+	if len(data) < HeaderSize {
+		err = HeaderNotCompleteErr
+		return
+	}
+	header.Size = binary.BigEndian.Uint32(data[0:4])
+	header.HeaderSize = binary.BigEndian.Uint16(data[4:6])
+	header.ProtoVer = api.DanmuProtol(binary.BigEndian.Uint16(data[6:8]))
+	header.OpCode = api.DanmuOp(binary.BigEndian.Uint32(data[8:12]))
+	header.Sequence = binary.BigEndian.Uint32(data[12:16])
+	if header.HeaderSize != HeaderSize ||
+		header.Size < HeaderSize ||
+		header.ProtoVer > api.DanmuProtolNormalBrotli ||
+		header.OpCode > api.DanmuOpAuthResp {
+		err = InvalidHeaderErr
+	}
+	return
+}
+
+// Pack 封一个包，protoVer为2或3时body按对应算法压缩，包长度按压缩后的数据计算
+func Pack(body []byte, protoVer api.DanmuProtol, op api.DanmuOp, seq uint32) []byte {
+	b := bytes.Buffer{}
+	b.Write(make([]byte, HeaderSize))
+	switch protoVer {
+	case api.DanmuProtolNormalZlib:
+		w := zlib.NewWriter(&b)
+		w.Write(body)
+		w.Close()
+	case api.DanmuProtolNormalBrotli:
+		w := brotli.NewWriter(&b)
+		w.Write(body)
+		w.Close()
+	default:
+		b.Write(body)
+	}
+	packet := b.Bytes()
+	binary.BigEndian.PutUint32(packet[0:4], uint32(len(packet)))
+	binary.BigEndian.PutUint16(packet[4:6], HeaderSize)
+	binary.BigEndian.PutUint16(packet[6:8], uint16(protoVer))
+	binary.BigEndian.PutUint32(packet[8:12], uint32(op))
+	binary.BigEndian.PutUint32(packet[12:16], seq)
+	return packet
+}
+
+// PackBatch 把多条消息按服务器的方式打成一个普通消息包，
+// 压缩协议下先各自封成未压缩的包再整体压缩
+func PackBatch(messages [][]byte, protoVer api.DanmuProtol) []byte {
+	switch protoVer {
+	case api.DanmuProtolNormalZlib, api.DanmuProtolNormalBrotli:
+		var inner []byte
+		for _, msg := range messages {
+			inner = append(inner, Pack(msg, api.DanmuProtolNormal, api.DanmuOpNormal, 0)...)
+		}
+		return Pack(inner, protoVer, api.DanmuOpNormal, 0)
+	}
+	var packets []byte
+	for _, msg := range messages {
+		packets = append(packets, Pack(msg, api.DanmuProtolNormal, api.DanmuOpNormal, 0)...)
+	}
+	return packets
+}
@@ -0,0 +1,195 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var protoVers = []api.DanmuProtol{api.DanmuProtolNormal, api.DanmuProtolNormalZlib, api.DanmuProtolNormalBrotli}
+
+// chunkReader 每次最多返回size字节，模拟一个包被拆成多次读取
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n = r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return
+}
+
+func testMessages(n int) (messages [][]byte) {
+	for i := 0; i < n; i++ {
+		messages = append(messages, []byte(fmt.Sprintf(`{"cmd":"DANMU_MSG","info":[[],"弹幕%d"]}`, i)))
+	}
+	return
+}
+
+// readAll 读出数据流中所有的消息
+func readAll(r io.Reader) (messages []string, err error) {
+	reader := NewReader(r)
+	decoder := new(Decoder)
+	for {
+		header, body, err := reader.Next()
+		if err == io.EOF {
+			return messages, nil
+		} else if err != nil {
+			return messages, err
+		}
+		if header.OpCode != api.DanmuOpNormal {
+			continue
+		}
+		err = decoder.Each(header.ProtoVer, body, func(msg []byte) {
+			messages = append(messages, string(msg))
+		})
+		if err != nil {
+			return messages, err
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, protoVer := range protoVers {
+		t.Run(fmt.Sprintf("protover%d", protoVer), func(t *testing.T) {
+			messages := testMessages(50)
+			stream := bytes.Buffer{}
+			stream.Write(PackBatch(messages[:30], protoVer))
+			stream.Write(Pack([]byte{0, 0, 0, 1}, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeatResp, 2))
+			stream.Write(PackBatch(messages[30:], protoVer))
+
+			got, err := readAll(&chunkReader{data: stream.Bytes(), size: 5})
+			if err != nil {
+				t.Fatalf("read failed, err=%v", err)
+			}
+			if len(got) != len(messages) {
+				t.Fatalf("expected %d messages, got %d", len(messages), len(got))
+			}
+			for i := range messages {
+				if got[i] != string(messages[i]) {
+					t.Errorf("message %d mismatch, got %s", i, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPackHeader(t *testing.T) {
+	packet := Pack([]byte("[object Object]"), api.DanmuProtolHeartBeat, api.DanmuOpHeartBeat, 7)
+	header, err := DecodeHeader(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := api.DanmuMessageHeader{Size: uint32(len(packet)), HeaderSize: HeaderSize, ProtoVer: api.DanmuProtolHeartBeat, OpCode: api.DanmuOpHeartBeat, Sequence: 7}
+	if header != expected {
+		t.Errorf("header mismatch, got %+v", header)
+	}
+	// 压缩后包长度是压缩后的长度
+	compressed := Pack(bytes.Repeat([]byte("弹幕"), 1000), api.DanmuProtolNormalBrotli, api.DanmuOpNormal, 0)
+	if header, _ = DecodeHeader(compressed); header.Size != uint32(len(compressed)) {
+		t.Errorf("compressed size mismatch, header=%d, packet=%d", header.Size, len(compressed))
+	}
+}
+
+func TestNestedBatch(t *testing.T) {
+	messages := testMessages(6)
+	// 外层brotli里套一个zlib批量包和一个普通包
+	inner := append(PackBatch(messages[:5], api.DanmuProtolNormalZlib), Pack(messages[5], api.DanmuProtolNormal, api.DanmuOpNormal, 0)...)
+	outer := Pack(inner, api.DanmuProtolNormalBrotli, api.DanmuOpNormal, 0)
+	got, err := readAll(bytes.NewReader(outer))
+	if err != nil {
+		t.Fatalf("read nested failed, err=%v", err)
+	}
+	if len(got) != 6 || got[5] != string(messages[5]) {
+		t.Errorf("nested messages mismatch, got %v", got)
+	}
+
+	nested := PackBatch(messages[:1], api.DanmuProtolNormal)
+	for i := 0; i <= maxNestDepth; i++ {
+		nested = Pack(nested, api.DanmuProtolNormalZlib, api.DanmuOpNormal, 0)
+	}
+	if _, err = readAll(bytes.NewReader(nested)); err != NestTooDeepErr {
+		t.Errorf("expected nest too deep, got %v", err)
+	}
+}
+
+func TestInvalidFrame(t *testing.T) {
+	packet := Pack([]byte("{}"), api.DanmuProtolNormal, api.DanmuOpNormal, 0)
+	bad := append([]byte{0, 0, 0, 18, 0, 8}, packet[6:]...)
+	if _, err := readAll(bytes.NewReader(bad)); err != InvalidHeaderErr {
+		t.Errorf("expected invalid header, got %v", err)
+	}
+	// 声明的压缩协议和实际数据不符
+	wrong := Pack(PackBatch(testMessages(1), api.DanmuProtolNormal), api.DanmuProtolNormal, api.DanmuOpNormal, 0)
+	wrong[7] = byte(api.DanmuProtolNormalZlib)
+	if _, err := readAll(bytes.NewReader(wrong)); err == nil {
+		t.Errorf("expected decompress error")
+	}
+	if _, err := DecodeHeader(packet[:10]); err != HeaderNotCompleteErr {
+		t.Errorf("expected header not complete, got %v", err)
+	}
+}
+
+func BenchmarkDecodeHeader(b *testing.B) {
+	packet := Pack([]byte("{}"), api.DanmuProtolNormal, api.DanmuOpNormal, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		DecodeHeader(packet)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	messages := testMessages(3)
+	for _, protoVer := range protoVers {
+		f.Add(PackBatch(messages, protoVer))
+	}
+	f.Add(Pack(PackBatch(messages, api.DanmuProtolNormalZlib), api.DanmuProtolNormalBrotli, api.DanmuOpNormal, 0))
+	f.Add(Pack([]byte{0, 0, 0, 1}, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeatResp, 1))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// 任意输入都不能panic，能解出来的消息重新封包后结果一致
+		got, err := readAll(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		var repacked [][]byte
+		for _, msg := range got {
+			repacked = append(repacked, []byte(msg))
+		}
+		again, err := readAll(bytes.NewReader(PackBatch(repacked, api.DanmuProtolNormalZlib)))
+		if err != nil {
+			t.Fatalf("repack failed, err=%v", err)
+		}
+		if len(again) != len(got) {
+			t.Fatalf("repack count mismatch, %d != %d", len(again), len(got))
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte(`{"cmd":"DANMU_MSG"}`), uint8(2))
+	f.Add([]byte{}, uint8(3))
+	f.Fuzz(func(t *testing.T, msg []byte, version uint8) {
+		protoVer := protoVers[int(version)%len(protoVers)]
+		got, err := readAll(bytes.NewReader(PackBatch([][]byte{msg}, protoVer)))
+		if err != nil {
+			t.Fatalf("round trip failed, protover=%d, err=%v", protoVer, err)
+		}
+		if len(got) != 1 || got[0] != string(msg) {
+			t.Fatalf("round trip mismatch, protover=%d, got %q", protoVer, got)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+const readBufferSize = 64 * 1024
+
+// Reader 从连接中逐帧读取，读缓冲和包体缓冲都会复用，
+// Next返回的body在下一次调用前有效
+type Reader struct {
+	r     *bufio.Reader
+	frame []byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, readBufferSize)}
+}
+
+func (r *Reader) Reset(src io.Reader) {
+	r.r.Reset(src)
+}
+
+func (r *Reader) Next() (header api.DanmuMessageHeader, body []byte, err error) {
+	head, err := r.r.Peek(HeaderSize)
+	if err != nil {
+		return
+	}
+	if header, err = DecodeHeader(head); err != nil {
+		return
+	}
+	if header.Size > MaxFrameSize {
+		err = FrameTooLargeErr
+		return
+	}
+	size := int(header.Size)
+	if cap(r.frame) < size {
+		r.frame = make([]byte, size)
+	}
+	r.frame = r.frame[:size]
+	if _, err = io.ReadFull(r.r, r.frame); err != nil {
+		return
+	}
+	body = r.frame[HeaderSize:]
+	return
+}
+
+// Raw 最近一次读到的完整数据包
+func (r *Reader) Raw() []byte {
+	return r.frame
+}
+
+var (
+	zlibReaderPool   sync.Pool
+	brotliReaderPool sync.Pool
+)
+
+// Decoder 解开压缩的消息包，解压缓冲会复用，不能在多个goroutine中同时使用
+type Decoder struct {
+	src   bytes.Reader
+	limit io.LimitedReader
+	bufs  [maxNestDepth]bytes.Buffer
+}
+
+// Each 对包体里的每一条消息调用fn，压缩包会先解压再逐个拆包，
+// 传给fn的数据在fn返回后就会被复用
+func (d *Decoder) Each(protoVer api.DanmuProtol, body []byte, fn func(msg []byte)) error {
+	return d.each(protoVer, body, fn, 0)
+}
+
+func (d *Decoder) each(protoVer api.DanmuProtol, body []byte, fn func(msg []byte), depth int) error {
+	switch protoVer {
+	case api.DanmuProtolNormal:
+		fn(body)
+		return nil
+	case api.DanmuProtolNormalZlib, api.DanmuProtolNormalBrotli:
+	default:
+		return nil
+	}
+	if depth >= maxNestDepth {
+		return NestTooDeepErr
+	}
+	data, err := d.inflate(protoVer, body, &d.bufs[depth])
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		inner, err := DecodeHeader(data)
+		if err != nil {
+			return err
+		}
+		if inner.Size > uint32(len(data)) {
+			return InvalidHeaderErr
+		}
+		if err = d.each(inner.ProtoVer, data[HeaderSize:inner.Size], fn, depth+1); err != nil {
+			return err
+		}
+		data = data[inner.Size:]
+	}
+	return nil
+}
+
+func (d *Decoder) inflate(protoVer api.DanmuProtol, body []byte, out *bytes.Buffer) (data []byte, err error) {
+	out.Reset()
+	d.src.Reset(body)
+	var r io.Reader
+	switch protoVer {
+	case api.DanmuProtolNormalZlib:
+		zr, ok := zlibReaderPool.Get().(io.ReadCloser)
+		if ok {
+			err = zr.(zlib.Resetter).Reset(&d.src, nil)
+		} else {
+			zr, err = zlib.NewReader(&d.src)
+		}
+		if err != nil {
+			return
+		}
+		defer zlibReaderPool.Put(zr)
+		r = zr
+	case api.DanmuProtolNormalBrotli:
+		br, ok := brotliReaderPool.Get().(*brotli.Reader)
+		if ok {
+			err = br.Reset(&d.src)
+		} else {
+			br = brotli.NewReader(&d.src)
+		}
+		if err != nil {
+			return
+		}
+		defer brotliReaderPool.Put(br)
+		r = br
+	}
+	d.limit = io.LimitedReader{R: r, N: MaxFrameSize + 1}
+	if _, err = out.ReadFrom(&d.limit); err != nil {
+		return
+	}
+	if out.Len() > MaxFrameSize {
+		return nil, FrameTooLargeErr
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/go-querystring/query"
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var NotModeratorErr = errors.New("not room admin or anchor")
+
+// CanModerate 登录的用户是主播或者房管时才能禁言和设置屏蔽词
+func CanModerate(room *api.LiveRoom) bool {
+	return room.UID != 0 && room.RoomUserInfo != nil && (room.UID == room.OwnerId || room.IsAdmin)
+}
+
+// MuteUser 禁言uid，hour为api.MuteHourThisLive时只禁言本场直播，api.MuteHourForever为永久
+func MuteUser(ctx context.Context, room *api.LiveRoom, uid uint64, hour int) (err error) {
+	req := api.SilentUserReq{
+		RoomID:    room.RoomID,
+		TUID:      uid,
+		MobileApp: "web",
+		Type:      1,
+		Hour:      hour,
+		CSRF:      room.CSRF,
+		CSRFToken: room.CSRF,
+	}
+	return postModeration(ctx, room, "/xlive/web-ucenter/v1/banned/AddSilentUser", req, nil)
+}
+
+func UnmuteUser(ctx context.Context, room *api.LiveRoom, uid uint64) (err error) {
+	req := api.SilentUserReq{RoomID: room.RoomID, TUID: uid, CSRF: room.CSRF, CSRFToken: room.CSRF}
+	return postModeration(ctx, room, "/xlive/web-ucenter/v1/banned/DelSilentUser", req, nil)
+}
+
+// GetMutedUsers 房间的禁言列表，page从1开始
+func GetMutedUsers(ctx context.Context, room *api.LiveRoom, page int) (resp *api.SilentUserListResp, err error) {
+	req := api.SilentUserListReq{RoomID: room.RoomID, Ps: page, CSRF: room.CSRF, CSRFToken: room.CSRF}
+	resp = new(api.SilentUserListResp)
+	err = postModeration(ctx, room, "/xlive/web-ucenter/v1/banned/GetSilentUserList", req, resp)
+	return
+}
+
+// maxMutedPages 禁言列表最多翻这么多页
+const maxMutedPages = 50
+
+// GetAllMutedUsers 按TotalPage翻完禁言列表
+func GetAllMutedUsers(ctx context.Context, room *api.LiveRoom) (users []api.SilentUser, err error) {
+	for page := 1; page <= maxMutedPages; page++ {
+		var resp *api.SilentUserListResp
+		if resp, err = GetMutedUsers(ctx, room, page); err != nil {
+			return nil, err
+		}
+		users = append(users, resp.Data.Data...)
+		if page >= resp.Data.TotalPage || len(resp.Data.Data) == 0 {
+			break
+		}
+	}
+	return
+}
+
+func AddShieldKeyword(ctx context.Context, room *api.LiveRoom, keyword string) (err error) {
+	req := api.ShieldKeywordReq{RoomID: room.RoomID, Keyword: keyword, CSRF: room.CSRF, CSRFToken: room.CSRF}
+	return postModeration(ctx, room, "/xlive/web-ucenter/v1/banned/AddShieldKeyword", req, nil)
+}
+
+func DelShieldKeyword(ctx context.Context, room *api.LiveRoom, keyword string) (err error) {
+	req := api.ShieldKeywordReq{RoomID: room.RoomID, Keyword: keyword, CSRF: room.CSRF, CSRFToken: room.CSRF}
+	return postModeration(ctx, room, "/xlive/web-ucenter/v1/banned/DelShieldKeyword", req, nil)
+}
+
+func GetShieldKeywords(ctx context.Context, room *api.LiveRoom) (resp *api.ShieldKeywordListResp, err error) {
+	if !CanModerate(room) {
+		return nil, NotModeratorErr
+	}
+	req := api.ShieldKeywordListReq{RoomID: room.RoomID}
+	resp = new(api.ShieldKeywordListResp)
+	err = room.Client.Get(ctx, room.Client.BaseURLs.Live+"/xlive/web-ucenter/v1/banned/GetShieldKeywordList", req, resp)
+	return
+}
+
+// postModeration 不是房管时不发请求，避免被风控
+func postModeration(ctx context.Context, room *api.LiveRoom, path string, req interface{}, out interface{}) (err error) {
+	if !CanModerate(room) {
+		return NotModeratorErr
+	}
+	form, err := query.Values(req)
+	if err != nil {
+		return
+	}
+	return room.Client.PostForm(ctx, room.Client.BaseURLs.Live+path, form, out)
+}
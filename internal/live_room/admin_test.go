@@ -0,0 +1,123 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func TestMuteUser(t *testing.T) {
+	server := startMockServer(t)
+	room := loginAndConnect(t, server)
+	if !CanModerate(room) {
+		t.Fatalf("mock user should be room admin")
+	}
+	ctx := context.Background()
+
+	server.PushDanmu(20002, "被禁言的人", "广告")
+	if err := MuteUser(ctx, room, 20002, 1); err != nil {
+		t.Fatalf("mute failed, err=%v", err)
+	}
+	list, err := GetMutedUsers(ctx, room, 1)
+	if err != nil {
+		t.Fatalf("get muted users failed, err=%v", err)
+	}
+	AssertEqual(t, len(list.Data.Data), 1)
+	AssertEqual(t, list.Data.Data[0].TUID, uint64(20002))
+	AssertEqual(t, list.Data.Data[0].TName, "被禁言的人")
+
+	// 先收到弹幕，再收到禁言消息
+	var blocked *api.RoomBlockMsgEvent
+	for blocked == nil {
+		select {
+		case msg := <-room.MessageChan:
+			event, err := DecodeEvent(msg)
+			if err != nil {
+				t.Fatalf("decode event failed, err=%v", err)
+			}
+			blocked, _ = event.(*api.RoomBlockMsgEvent)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ROOM_BLOCK_MSG not received")
+		}
+	}
+	AssertEqual(t, blocked.UName, "被禁言的人")
+
+	if err = UnmuteUser(ctx, room, 20002); err != nil {
+		t.Fatalf("unmute failed, err=%v", err)
+	}
+	AssertEqual(t, len(server.MutedUsers()), 0)
+	if err = UnmuteUser(ctx, room, 20002); !api.IsCode(err, api.CodeDanmuInvalid) {
+		t.Errorf("unmute twice, err=%v", err)
+	}
+}
+
+func TestMutedUsersPages(t *testing.T) {
+	server := startMockServer(t)
+	room := loginAndConnect(t, server)
+	ctx := context.Background()
+	// 不限速，一次禁言很多人
+	room.Client.RateLimit = 0
+	for uid := uint64(1); uid <= 25; uid++ {
+		if err := MuteUser(ctx, room, 30000+uid, api.MuteHourThisLive); err != nil {
+			t.Fatalf("mute failed, err=%v", err)
+		}
+	}
+	first, err := GetMutedUsers(ctx, room, 1)
+	if err != nil {
+		t.Fatalf("get muted users failed, err=%v", err)
+	}
+	AssertEqual(t, len(first.Data.Data), 10)
+	AssertEqual(t, first.Data.TotalPage, 3)
+	users, err := GetAllMutedUsers(ctx, room)
+	if err != nil {
+		t.Fatalf("get all muted users failed, err=%v", err)
+	}
+	AssertEqual(t, len(users), 25)
+	AssertEqual(t, users[24].TUID, uint64(30025))
+}
+
+func TestShieldKeyword(t *testing.T) {
+	server := startMockServer(t)
+	room := loginAndConnect(t, server)
+	ctx := context.Background()
+
+	if err := AddShieldKeyword(ctx, room, "加群"); err != nil {
+		t.Fatalf("add keyword failed, err=%v", err)
+	}
+	list, err := GetShieldKeywords(ctx, room)
+	if err != nil {
+		t.Fatalf("get keywords failed, err=%v", err)
+	}
+	AssertEqual(t, len(list.Data.KeywordList), 1)
+	AssertEqual(t, list.Data.KeywordList[0].Keyword, "加群")
+	if err = sendForm(t, room.Client, "快来加群"); !errors.Is(err, DanmuRoomShieldedErr) {
+		t.Errorf("send with room keyword, err=%v", err)
+	}
+	if err = DelShieldKeyword(ctx, room, "加群"); err != nil {
+		t.Fatalf("delete keyword failed, err=%v", err)
+	}
+	AssertEqual(t, len(server.ShieldKeywords()), 0)
+}
+
+func TestNotModerator(t *testing.T) {
+	server := startMockServer(t)
+	server.RoomAdmin = false
+	room := loginAndConnect(t, server)
+	if CanModerate(room) {
+		t.Fatalf("mock user should not be room admin")
+	}
+	if err := MuteUser(context.Background(), room, 20002, api.MuteHourThisLive); !errors.Is(err, NotModeratorErr) {
+		t.Errorf("mute without permission, err=%v", err)
+	}
+	// 主播自己也可以管理
+	room.OwnerId = room.UID
+	if !CanModerate(room) {
+		t.Errorf("anchor should be able to moderate")
+	}
+	if err := MuteUser(context.Background(), room, 20002, api.MuteHourThisLive); !api.IsCode(err, -403) {
+		t.Errorf("mock server should reject non admin, err=%v", err)
+	}
+}
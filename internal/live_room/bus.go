@@ -0,0 +1,200 @@
+package live_room
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+type OverflowPolicy uint8
+
+const (
+	// OverflowDrop 订阅者缓冲满时丢弃这条消息，不影响其他订阅者
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock 订阅者缓冲满时等待，会拖慢所有订阅者
+	OverflowBlock
+)
+
+type SubscribeOption struct {
+	// Cmds 只接收这些cmd的消息，为空时接收全部
+	Cmds   []string
+	Buffer int
+	Policy OverflowPolicy
+}
+
+type Subscription struct {
+	C       <-chan *api.DanmuMessage
+	ch      chan *api.DanmuMessage
+	cmds    map[string]struct{}
+	policy  OverflowPolicy
+	bus     *Bus
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Bus 把一个房间的消息分发给多个订阅者，每个订阅者有自己的缓冲和溢出策略
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	done   chan struct{}
+	closed bool
+	once   sync.Once
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Subscribe 总线关闭后订阅会得到一个已关闭的channel
+func (b *Bus) Subscribe(option SubscribeOption) *Subscription {
+	if option.Buffer <= 0 {
+		option.Buffer = 10
+	}
+	ch := make(chan *api.DanmuMessage, option.Buffer)
+	sub := &Subscription{
+		C:      ch,
+		ch:     ch,
+		policy: option.Policy,
+		bus:    b,
+		done:   make(chan struct{}),
+	}
+	if len(option.Cmds) > 0 {
+		sub.cmds = make(map[string]struct{}, len(option.Cmds))
+		for _, cmd := range option.Cmds {
+			sub.cmds[cmd] = struct{}{}
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.done)
+		close(ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe 可以重复调用，之后C会被关闭
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		// 先让阻塞在这个订阅者上的发布返回，再拿写锁
+		close(s.done)
+		s.bus.mu.Lock()
+		defer s.bus.mu.Unlock()
+		if _, ok := s.bus.subs[s]; ok {
+			delete(s.bus.subs, s)
+			close(s.ch)
+		}
+	})
+}
+
+// Dropped 因为缓冲满被丢弃的消息数
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) match(cmd string) bool {
+	if s.cmds == nil {
+		return true
+	}
+	_, ok := s.cmds[cmd]
+	return ok
+}
+
+func (b *Bus) Publish(msg *api.DanmuMessage) {
+	cmd := NormalizeCmd(msg.Cmd)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.match(cmd) {
+			continue
+		}
+		switch sub.policy {
+		case OverflowBlock:
+			select {
+			case sub.ch <- msg:
+			case <-sub.done:
+			case <-b.done:
+			}
+		default:
+			select {
+			case sub.ch <- msg:
+			default:
+				atomic.AddUint64(&sub.dropped, 1)
+			}
+		}
+	}
+}
+
+// Close 关闭所有订阅者的channel
+func (b *Bus) Close() {
+	b.once.Do(func() {
+		close(b.done)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.closed = true
+		for sub := range b.subs {
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	})
+}
+
+// Run 把in中的消息分发给订阅者，done关闭或者in关闭时关闭总线
+func (b *Bus) Run(in <-chan *api.DanmuMessage, done <-chan struct{}) {
+	defer b.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-done:
+			// 发布可能阻塞在慢订阅者上，先关闭总线让它返回
+			b.Close()
+		case <-stop:
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case msg, ok := <-in:
+			if !ok {
+				return
+			}
+			b.Publish(msg)
+		}
+	}
+}
+
+// roomBus 挂在房间上的总线，第一次订阅时才开始分发，之前的消息留在队列里
+type roomBus struct {
+	*Bus
+	once sync.Once
+}
+
+func NewRoomBus() api.MessageBus {
+	return &roomBus{Bus: NewBus()}
+}
+
+// Subscribe 订阅房间的消息，房间关闭时C也会关闭，没有总线的房间得到一个已关闭的订阅
+func Subscribe(room *api.LiveRoom, option SubscribeOption) *Subscription {
+	rb, ok := room.Bus.(*roomBus)
+	if !ok {
+		bus := NewBus()
+		bus.Close()
+		return bus.Subscribe(option)
+	}
+	sub := rb.Subscribe(option)
+	rb.once.Do(func() {
+		if !room.Go(func() { rb.Run(room.MessageChan, room.DoneChan) }) {
+			rb.Close()
+		}
+	})
+	return sub
+}
@@ -0,0 +1,114 @@
+package live_room
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func receive(t *testing.T, sub *Subscription) *api.DanmuMessage {
+	t.Helper()
+	select {
+	case msg, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("subscription closed")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("receive timeout")
+	}
+	return nil
+}
+
+func TestBusFanOut(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(SubscribeOption{})
+	danmu := bus.Subscribe(SubscribeOption{Cmds: []string{api.CmdDanmuMsg}})
+	in := make(chan *api.DanmuMessage)
+	done := make(chan struct{})
+	go bus.Run(in, done)
+
+	in <- &api.DanmuMessage{Cmd: api.CmdSendGift}
+	in <- &api.DanmuMessage{Cmd: "DANMU_MSG:4:0:2:2:2:0"}
+	AssertEqual(t, receive(t, all).Cmd, api.CmdSendGift)
+	AssertEqual(t, receive(t, all).Cmd, "DANMU_MSG:4:0:2:2:2:0")
+	AssertEqual(t, receive(t, danmu).Cmd, "DANMU_MSG:4:0:2:2:2:0")
+
+	close(done)
+	for _, sub := range []*Subscription{all, danmu} {
+		select {
+		case _, ok := <-sub.C:
+			if ok {
+				t.Fatalf("unexpected message")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscription not closed after done")
+		}
+	}
+	late := bus.Subscribe(SubscribeOption{})
+	if _, ok := <-late.C; ok {
+		t.Fatalf("subscribe after close should be closed")
+	}
+}
+
+func TestBusOverflow(t *testing.T) {
+	bus := NewBus()
+	drop := bus.Subscribe(SubscribeOption{Buffer: 1, Policy: OverflowDrop})
+	block := bus.Subscribe(SubscribeOption{Buffer: 1, Policy: OverflowBlock})
+	msg := &api.DanmuMessage{Cmd: api.CmdDanmuMsg}
+	bus.Publish(msg)
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(msg)
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatalf("block subscriber should block publish")
+	case <-time.After(50 * time.Millisecond):
+	}
+	receive(t, block)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("publish still blocked")
+	}
+	AssertEqual(t, drop.Dropped(), uint64(1))
+	AssertEqual(t, block.Dropped(), uint64(0))
+
+	// 阻塞中的订阅者退订后发布应该立刻返回
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		block.Unsubscribe()
+	}()
+	bus.Publish(msg)
+	block.Unsubscribe()
+	bus.Close()
+}
+
+func TestRoomSubscribe(t *testing.T) {
+	room := &api.LiveRoom{
+		MessageChan: make(chan *api.DanmuMessage, 10),
+		Bus:         NewRoomBus(),
+	}
+	room.Start(context.Background())
+	ui := Subscribe(room, SubscribeOption{Buffer: 1, Policy: OverflowBlock})
+	logger := Subscribe(room, SubscribeOption{Cmds: []string{api.CmdDanmuMsg}})
+	room.MessageChan <- &api.DanmuMessage{Cmd: api.CmdDanmuMsg}
+	AssertEqual(t, receive(t, ui).Cmd, api.CmdDanmuMsg)
+	AssertEqual(t, receive(t, logger).Cmd, api.CmdDanmuMsg)
+
+	// 阻塞的订阅者不读也不影响房间关闭
+	room.MessageChan <- &api.DanmuMessage{Cmd: api.CmdDanmuMsg}
+	room.MessageChan <- &api.DanmuMessage{Cmd: api.CmdDanmuMsg}
+	room.Close()
+	for range ui.C {
+	}
+	for range logger.C {
+	}
+	_, ok := <-Subscribe(room, SubscribeOption{}).C
+	AssertEqual(t, ok, false)
+}
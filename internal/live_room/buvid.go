@@ -0,0 +1,79 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var BuvidFetchErr = errors.New("buvid not found in response")
+
+// buvidCookieNames 游客身份需要的cookie，保存和恢复时只关心这几个
+var buvidCookieNames = []string{"buvid3", "buvid4", "b_nut"}
+
+// EnsureBuvid 把保存的buvid放进client的cookie里，没有保存过时向服务器申请一个新的，
+// 返回的cookie字符串和saved不同时需要调用方保存下来，下次启动继续使用
+func EnsureBuvid(ctx context.Context, client *api.Client, saved string) (cookie string, err error) {
+	cookies := filterBuvidCookies(readCookies(saved))
+	if len(cookies) == 0 || cookies[0].Name != "buvid3" {
+		if cookies, err = fetchBuvid(ctx, client); err != nil {
+			return
+		}
+	}
+	setJarCookies(client, cookies)
+	return joinCookies(cookies), nil
+}
+
+func fetchBuvid(ctx context.Context, client *api.Client) (cookies []*http.Cookie, err error) {
+	var buvidResp api.BuvidResp
+	if err = client.Get(ctx, client.BaseURLs.Main+"/x/frontend/finger/spi", nil, &buvidResp); err != nil {
+		return
+	}
+	if buvidResp.Data.B3 == "" {
+		err = BuvidFetchErr
+		return
+	}
+	cookies = []*http.Cookie{{Name: "buvid3", Value: buvidResp.Data.B3}}
+	if buvidResp.Data.B4 != "" {
+		cookies = append(cookies, &http.Cookie{Name: "buvid4", Value: buvidResp.Data.B4})
+	}
+	// b_nut是第一次访问的时间
+	cookies = append(cookies, &http.Cookie{Name: "b_nut", Value: strconv.FormatInt(time.Now().Unix(), 10)})
+	return
+}
+
+// GetBuvid 从client的cookie里取出buvid3，弹幕服务器认证时需要
+func GetBuvid(client *api.Client) string {
+	return jarCookie(client, "buvid3")
+}
+
+// readCookies 解析"a=1; b=2"格式的cookie字符串
+func readCookies(cookies string) []*http.Cookie {
+	return (&http.Request{Header: http.Header{"Cookie": {cookies}}}).Cookies()
+}
+
+// filterBuvidCookies 按buvidCookieNames的顺序取出游客身份相关的cookie
+func filterBuvidCookies(cookies []*http.Cookie) (filtered []*http.Cookie) {
+	for _, name := range buvidCookieNames {
+		for _, cookie := range cookies {
+			if cookie.Name == name && cookie.Value != "" {
+				filtered = append(filtered, cookie)
+				break
+			}
+		}
+	}
+	return
+}
+
+func joinCookies(cookies []*http.Cookie) string {
+	parts := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		parts = append(parts, cookie.Name+"="+cookie.Value)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,57 @@
+package live_room
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func TestEnsureBuvid(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+
+	// 第一次运行时申请新的buvid
+	cookie, err := EnsureBuvid(context.Background(), client, "")
+	if err != nil {
+		t.Fatalf("EnsureBuvid Error, %v", err)
+	}
+	if !strings.HasPrefix(cookie, "buvid3="+mock_server.MockBuvid3+"; buvid4="+mock_server.MockBuvid4+"; b_nut=") {
+		t.Errorf("unexpected buvid cookie %s", cookie)
+	}
+	AssertEqual(t, GetBuvid(client), mock_server.MockBuvid3)
+
+	// 保存过的buvid原样使用，不再申请
+	saved := "buvid3=saved-buvid3; buvid4=saved-buvid4; b_nut=1700000000"
+	client = newClient(server)
+	if cookie, err = EnsureBuvid(context.Background(), client, saved+"; other=1"); err != nil {
+		t.Fatalf("EnsureBuvid with saved cookie Error, %v", err)
+	}
+	AssertEqual(t, cookie, saved)
+	AssertEqual(t, GetBuvid(client), "saved-buvid3")
+
+	// 登录后设置的cookie不会覆盖buvid
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+	AssertEqual(t, GetBuvid(client), "saved-buvid3")
+	AssertEqual(t, CheckAuth(context.Background(), client), true)
+}
+
+func TestAuthWithBuvid(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	if _, err := EnsureBuvid(context.Background(), client, ""); err != nil {
+		t.Fatalf("EnsureBuvid Error, %v", err)
+	}
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	defer room.Close()
+	AssertEqual(t, room.Buvid, mock_server.MockBuvid3)
+	buvids := server.AuthBuvids()
+	if len(buvids) != 1 || buvids[0] != mock_server.MockBuvid3 {
+		t.Errorf("danmu auth should carry buvid, got %v", buvids)
+	}
+}
@@ -1,32 +1,37 @@
 package live_room
 
 import (
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"github.com/google/go-querystring/query"
 	"github.com/shr-go/bili_live_tui/api"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
-	"io"
-	"net/http"
 	"time"
 )
 
-func AuthAndConnect(client *http.Client, roomID uint64) (room *api.LiveRoom, err error) {
+func AuthAndConnect(ctx context.Context, client *api.Client, config *api.BiliLiveConfig) (room *api.LiveRoom, err error) {
 	uid := uint64(0)
-	if userInfo := GetUserInfo(client); userInfo != nil {
+	if userInfo, err := GetUserInfo(ctx, client); err == nil {
 		uid = userInfo.Data.Mid
 	}
-	roomInfo, err := GetRoomInfo(client, roomID)
+	roomInfo, err := GetRoomInfo(ctx, client, config.RoomID)
 	if err != nil {
 		return
 	}
 	realRoomID := uint64(roomInfo.Data.RoomId)
-	info, err := GetDanmuInfo(client, realRoomID)
+	info, err := GetDanmuInfo(ctx, client, realRoomID)
 	if err != nil {
 		return
 	}
-	room, err = ConnectDanmuServer(uid, realRoomID, info)
+	// 房间信息都在启动读写协程之前拿到，连接建立后不再有并发写
+	var userRoomInfo *api.UserRoomInfo
+	authed := CheckAuth(ctx, client)
+	if authed {
+		if userRoomInfo, err = GetUserRoomInfo(ctx, client, realRoomID); err != nil {
+			return
+		}
+	}
+	room, start, err := dialDanmuServer(ctx, uid, GetBuvid(client), realRoomID, info, config)
 	if err != nil {
 		return
 	}
@@ -34,19 +39,16 @@ func AuthAndConnect(client *http.Client, roomID uint64) (room *api.LiveRoom, err
 	room.ShortID = uint64(roomInfo.Data.ShortId)
 	room.OwnerId = uint64(roomInfo.Data.Uid)
 	room.Client = client
-
-	if CheckAuth(client) {
-		userRoomInfo, err := GetUserRoomInfo(client, realRoomID)
-		if err != nil {
-			return nil, err
-		}
+	if authed {
 		roomUserInfo := userRoomInfo.Data.Property
 		room.RoomUserInfo = &roomUserInfo
+		room.IsAdmin = userRoomInfo.Data.Badge.IsRoomAdmin
 		room.CSRF = getCSRF(client)
+	}
+	start()
+	if authed {
 		// 处理心跳
-		go processHeartBeat(room)
-	} else {
-		room.RoomUserInfo = nil
+		room.Go(func() { processHeartBeat(room) })
 	}
 	return
 }
@@ -61,7 +63,7 @@ Loop:
 		case <-room.DoneChan:
 			break Loop
 		case <-heartBeatTicker.C:
-			newNextInterval := roomHeartBeatReq(room.Client, nextInterval, room.RoomID)
+			newNextInterval := roomHeartBeatReq(room.Context(), room.Client, nextInterval, room.RoomID)
 			if newNextInterval != nextInterval {
 				nextInterval = newNextInterval
 				heartBeatTicker.Reset(time.Duration(nextInterval) * time.Second)
@@ -70,7 +72,7 @@ Loop:
 	}
 }
 
-func roomHeartBeatReq(client *http.Client, nextInterval int, realRoomID uint64) int {
+func roomHeartBeatReq(ctx context.Context, client *api.Client, nextInterval int, realRoomID uint64) int {
 	logging.Debugf("roomHeartBeatReq, nextInterval=%d, realRoomID=%d", nextInterval, realRoomID)
 	hb := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%d|%d|1|0", nextInterval, realRoomID)))
 	params := struct {
@@ -80,29 +82,18 @@ func roomHeartBeatReq(client *http.Client, nextInterval int, realRoomID uint64)
 		HB: hb,
 		PF: "web",
 	}
-	v, err := query.Values(params)
-	if err != nil {
-		logging.Errorf("heart beat error, err=%v", err)
-	}
-	baseURL := "https://live-trace.bilibili.com/xlive/rdata-interface/v1/heartbeat/webHeartBeat"
-	realUrl := fmt.Sprintf("%s?%s", baseURL, v.Encode())
-	resp, err := client.Get(realUrl)
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logging.Errorf("heart beat error, err=%v", err)
-	}
 	var data struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-		Ttl     int    `json:"ttl"`
-		Data    struct {
+		Data struct {
 			NextInterval int `json:"next_interval"`
 		} `json:"data"`
 	}
-
-	if err = json.Unmarshal(body, &data); err != nil || data.Code != 0 {
-		logging.Errorf("heart beat error, err=%v, data=%v", err, data)
+	baseURL := client.BaseURLs.LiveTrace + "/xlive/rdata-interface/v1/heartbeat/webHeartBeat"
+	if err := client.Get(ctx, baseURL, params, &data); err != nil {
+		logging.Errorf("heart beat error, err=%v", err)
+		return nextInterval
+	}
+	if data.Data.NextInterval <= 0 {
+		return nextInterval
 	}
 	return data.Data.NextInterval
 }
@@ -0,0 +1,15 @@
+package live_room
+
+import (
+	"context"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+// GetEmoticons 获取当前用户在房间里可以看到的表情包，需要登录
+func GetEmoticons(ctx context.Context, client *api.Client, roomID uint64) (resp *api.EmoticonResp, err error) {
+	req := api.EmoticonReq{Platform: "pc", RoomID: roomID}
+	resp = new(api.EmoticonResp)
+	err = client.Get(ctx, client.BaseURLs.Live+"/xlive/web-ucenter/v2/emoticon/GetEmoticons", req, resp)
+	return
+}
@@ -0,0 +1,45 @@
+package live_room
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func TestEmoticons(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+
+	if _, err := GetEmoticons(context.Background(), client, server.RoomID); !api.IsCode(err, api.CodeNotLogin) {
+		t.Errorf("get emoticons before login, err=%v", err)
+	}
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+	resp, err := GetEmoticons(context.Background(), client, server.RoomID)
+	if err != nil {
+		t.Fatalf("get emoticons failed, err=%v", err)
+	}
+	AssertEqual(t, len(resp.Data.Data), 2)
+	locked := resp.Data.Data[1].Emoticons[0]
+	AssertEqual(t, locked.Perm, 0)
+
+	send := func(unique string) error {
+		form := url.Values{
+			"msg":     {unique},
+			"dm_type": {strconv.Itoa(api.DmTypeEmoticon)},
+			"csrf":    {mock_server.MockCSRF},
+		}
+		return SendDanmu(context.Background(), client, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	}
+	if err = send(resp.Data.Data[0].Emoticons[0].EmoticonUnique); err != nil {
+		t.Errorf("send emoticon failed, err=%v", err)
+	}
+	if err = send(locked.EmoticonUnique); !api.IsCode(err, api.CodeDanmuInvalid) {
+		t.Errorf("send locked emoticon, err=%v", err)
+	}
+}
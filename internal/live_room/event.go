@@ -0,0 +1,209 @@
+package live_room
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+// EventSchemaError 消息的结构和预期不一致，一般是B站改了字段
+type EventSchemaError struct {
+	Cmd string
+	Err error
+}
+
+func (e *EventSchemaError) Error() string {
+	return fmt.Sprintf("event schema mismatch, cmd=%s, err=%v", e.Cmd, e.Err)
+}
+
+func (e *EventSchemaError) Unwrap() error {
+	return e.Err
+}
+
+var missingDataErr = errors.New("data missing")
+
+// dataEvents 字段放在data里的消息
+var dataEvents = map[string]func() api.Event{
+	api.CmdSendGift:                  func() api.Event { return new(api.SendGiftEvent) },
+	api.CmdComboSend:                 func() api.Event { return new(api.ComboSendEvent) },
+	api.CmdSuperChatMessage:          func() api.Event { return new(api.SuperChatEvent) },
+	api.CmdSuperChatMessageDelete:    func() api.Event { return new(api.SuperChatDeleteEvent) },
+	api.CmdGuardBuy:                  func() api.Event { return new(api.GuardBuyEvent) },
+	api.CmdInteractWord:              func() api.Event { return new(api.InteractWordEvent) },
+	api.CmdEntryEffect:               func() api.Event { return new(api.EntryEffectEvent) },
+	api.CmdWatchedChange:             func() api.Event { return new(api.WatchedChangeEvent) },
+	api.CmdOnlineRankCount:           func() api.Event { return new(api.OnlineRankCountEvent) },
+	api.CmdLikeInfoV3Update:          func() api.Event { return new(api.LikeInfoUpdateEvent) },
+	api.CmdRoomChange:                func() api.Event { return new(api.RoomChangeEvent) },
+	api.CmdRoomRealTimeMessageUpdate: func() api.Event { return new(api.RoomRealTimeMessageUpdateEvent) },
+	api.CmdRoomBlockMsg:              func() api.Event { return new(api.RoomBlockMsgEvent) },
+}
+
+// topLevelEvents 字段和cmd同级的消息
+var topLevelEvents = map[string]func() api.Event{
+	api.CmdLive:      func() api.Event { return new(api.LiveEvent) },
+	api.CmdPreparing: func() api.Event { return new(api.PreparingEvent) },
+	api.CmdWarning:   func() api.Event { return new(api.WarningEvent) },
+	api.CmdCutOff:    func() api.Event { return new(api.CutOffEvent) },
+}
+
+// NormalizeCmd 去掉cmd后面的附加参数，比如DANMU_MSG:4:0:2:2:2:0
+func NormalizeCmd(cmd string) string {
+	if i := strings.IndexByte(cmd, ':'); i >= 0 {
+		return cmd[:i]
+	}
+	return cmd
+}
+
+// DecodeEvent 把消息解码成对应的类型，结构不符时返回EventSchemaError，
+// 没有对应类型的消息返回UnknownEvent
+func DecodeEvent(msg *api.DanmuMessage) (event api.Event, err error) {
+	raw := msg.Raw
+	if raw == nil {
+		if raw, err = json.Marshal(msg); err != nil {
+			return
+		}
+	}
+	cmd := NormalizeCmd(msg.Cmd)
+	if cmd == api.CmdDanmuMsg {
+		return decodeDanmuMsg(raw)
+	}
+	if newEvent, ok := dataEvents[cmd]; ok {
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err = json.Unmarshal(raw, &envelope); err != nil {
+			return nil, &EventSchemaError{Cmd: cmd, Err: err}
+		}
+		if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+			return nil, &EventSchemaError{Cmd: cmd, Err: missingDataErr}
+		}
+		event = newEvent()
+		if err = json.Unmarshal(envelope.Data, event); err != nil {
+			return nil, &EventSchemaError{Cmd: cmd, Err: err}
+		}
+		return
+	}
+	if newEvent, ok := topLevelEvents[cmd]; ok {
+		event = newEvent()
+		if err = json.Unmarshal(raw, event); err != nil {
+			return nil, &EventSchemaError{Cmd: cmd, Err: err}
+		}
+		return
+	}
+	return &api.UnknownEvent{Cmd: msg.Cmd, Raw: raw}, nil
+}
+
+type positional []json.RawMessage
+
+// field 按位置取出字段，path只用于错误信息
+func (p positional) field(i int, path string, v interface{}) error {
+	if i >= len(p) {
+		return fmt.Errorf("%s[%d] missing", path, i)
+	}
+	if err := json.Unmarshal(p[i], v); err != nil {
+		return fmt.Errorf("%s[%d]: %w", path, i, err)
+	}
+	return nil
+}
+
+func decodeDanmuMsg(raw []byte) (api.Event, error) {
+	event, err := decodeDanmuInfo(raw)
+	if err != nil {
+		return nil, &EventSchemaError{Cmd: api.CmdDanmuMsg, Err: err}
+	}
+	return event, nil
+}
+
+// parseDanmuExtra extra里的字段经常变动，解析失败时忽略
+func parseDanmuExtra(event *api.DanmuMsgEvent) {
+	var extra struct {
+		IDStr      string `json:"id_str"`
+		ReplyMid   uint64 `json:"reply_mid"`
+		ReplyUName string `json:"reply_uname"`
+	}
+	if err := json.Unmarshal([]byte(event.Extra), &extra); err != nil {
+		return
+	}
+	event.DmID = extra.IDStr
+	event.ReplyMid = extra.ReplyMid
+	event.ReplyUName = extra.ReplyUName
+}
+
+func decodeDanmuInfo(raw []byte) (event *api.DanmuMsgEvent, err error) {
+	var envelope struct {
+		Info positional `json:"info"`
+	}
+	if err = json.Unmarshal(raw, &envelope); err != nil {
+		return
+	}
+	info := envelope.Info
+	var basicInfo, userInfo, medalInfo positional
+	event = new(api.DanmuMsgEvent)
+	var sendTime int64
+	if err = info.field(0, "info", &basicInfo); err != nil {
+		return
+	}
+	if err = info.field(1, "info", &event.Content); err != nil {
+		return
+	}
+	if err = info.field(2, "info", &userInfo); err != nil {
+		return
+	}
+	if err = info.field(3, "info", &medalInfo); err != nil {
+		return
+	}
+	if err = basicInfo.field(1, "info[0]", &event.Mode); err != nil {
+		return
+	}
+	if err = basicInfo.field(3, "info[0]", &event.ContentColor); err != nil {
+		return
+	}
+	if err = basicInfo.field(4, "info[0]", &sendTime); err != nil {
+		return
+	}
+	event.SendTime = time.UnixMilli(sendTime)
+	if len(basicInfo) > 15 {
+		var extra struct {
+			Extra string `json:"extra"`
+		}
+		if err = basicInfo.field(15, "info[0]", &extra); err != nil {
+			return
+		}
+		event.Extra = extra.Extra
+		parseDanmuExtra(event)
+	}
+	if err = userInfo.field(0, "info[2]", &event.UID); err != nil {
+		return
+	}
+	if err = userInfo.field(1, "info[2]", &event.UName); err != nil {
+		return
+	}
+	if len(userInfo) > 7 {
+		if err = userInfo.field(7, "info[2]", &event.NameColor); err != nil {
+			return
+		}
+	}
+	// 没有佩戴粉丝勋章时是空数组
+	if len(medalInfo) > 10 {
+		medal := new(api.MedalInfo)
+		if err = medalInfo.field(0, "info[3]", &medal.Level); err != nil {
+			return
+		}
+		if err = medalInfo.field(1, "info[3]", &medal.Name); err != nil {
+			return
+		}
+		if err = medalInfo.field(4, "info[3]", &medal.Color); err != nil {
+			return
+		}
+		if err = medalInfo.field(10, "info[3]", &medal.ShipLevel); err != nil {
+			return
+		}
+		event.Medal = medal
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package live_room
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func loadEventMessage(t *testing.T, name string) *api.DanmuMessage {
+	raw, err := os.ReadFile(filepath.Join("testdata", "events", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := new(api.DanmuMessage)
+	if err = json.Unmarshal(raw, msg); err != nil {
+		t.Fatalf("invalid payload %s, err=%v", name, err)
+	}
+	msg.Raw = raw
+	return msg
+}
+
+func TestDecodeEvent(t *testing.T) {
+	cases := []struct {
+		file  string
+		check func(t *testing.T, event api.Event)
+	}{
+		{"danmu_msg.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.DanmuMsgEvent)
+			AssertEqual(t, e.UID, uint64(15363296))
+			AssertEqual(t, e.UName, "测试用户")
+			AssertEqual(t, e.Content, "晚上好")
+			AssertEqual(t, e.ContentColor, int64(14893055))
+			AssertEqual(t, e.SendTime.UnixMilli(), int64(1665839440612))
+			AssertEqual(t, e.NameColor, "#00D1F1")
+			if e.Medal == nil {
+				t.Fatalf("medal missing")
+			}
+			AssertEqual(t, *e.Medal, api.MedalInfo{Level: 21, Name: "小勋章", Color: 1725515, ShipLevel: 3})
+			if e.Extra == "" {
+				t.Errorf("extra missing")
+			}
+			AssertEqual(t, e.DmID, "c2e4c3d4e1a0b")
+			AssertEqual(t, e.ReplyMid, uint64(0))
+		}},
+		{"danmu_msg_reply.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.DanmuMsgEvent)
+			AssertEqual(t, e.Content, "晚上好")
+			AssertEqual(t, e.ReplyMid, uint64(15363296))
+			AssertEqual(t, e.ReplyUName, "测试用户")
+		}},
+		{"danmu_msg_no_medal.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.DanmuMsgEvent)
+			AssertEqual(t, e.Content, "路过")
+			if e.Medal != nil {
+				t.Errorf("empty medal array should decode as nil")
+			}
+		}},
+		{"send_gift.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.SendGiftEvent)
+			AssertEqual(t, e.GiftName, "小花花")
+			AssertEqual(t, e.Num, 1)
+			AssertEqual(t, e.CoinType, "gold")
+			AssertEqual(t, e.UID, uint64(15363296))
+		}},
+		{"combo_send.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.ComboSendEvent)
+			AssertEqual(t, e.ComboNum, 9)
+			AssertEqual(t, e.GiftName, "小花花")
+		}},
+		{"super_chat_message.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.SuperChatEvent)
+			AssertEqual(t, e.Price, 30)
+			AssertEqual(t, e.ID, api.FlexInt(5397385))
+			AssertEqual(t, e.UserInfo.UName, "测试用户")
+			AssertEqual(t, e.MedalInfo.GuardLevel, 3)
+		}},
+		{"super_chat_message_delete.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.SuperChatDeleteEvent)
+			AssertEqual(t, len(e.IDs), 1)
+		}},
+		{"guard_buy.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.GuardBuyEvent)
+			AssertEqual(t, e.GuardLevel, uint8(3))
+			AssertEqual(t, e.UName, "测试用户")
+		}},
+		{"interact_word.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.InteractWordEvent)
+			AssertEqual(t, e.MsgType, api.InteractEnter)
+			AssertEqual(t, e.UName, "进场的人")
+			AssertEqual(t, e.FansMedal.MedalLevel, 9)
+		}},
+		{"entry_effect.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.EntryEffectEvent)
+			AssertEqual(t, e.PrivilegeType, 3)
+		}},
+		{"watched_change.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.WatchedChangeEvent).Num, int64(12345))
+		}},
+		{"online_rank_count.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.OnlineRankCountEvent).Count, int64(1024))
+		}},
+		{"like_info_v3_update.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.LikeInfoUpdateEvent).ClickCount, int64(52013))
+		}},
+		{"room_change.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.RoomChangeEvent).Title, "新的直播标题")
+		}},
+		{"room_real_time_message_update.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.RoomRealTimeMessageUpdateEvent).Fans, int64(100000))
+		}},
+		{"room_block_msg.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.RoomBlockMsgEvent)
+			AssertEqual(t, e.UID, api.FlexInt(20002))
+			AssertEqual(t, e.UName, "被禁言的人")
+		}},
+		{"live.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.LiveEvent).RoomID, api.FlexInt(7777))
+		}},
+		{"preparing.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.PreparingEvent).RoomID, api.FlexInt(7777))
+		}},
+		{"warning.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.WarningEvent).Msg, "违反直播规范，请立即调整")
+		}},
+		{"cut_off.json", func(t *testing.T, event api.Event) {
+			AssertEqual(t, event.(*api.CutOffEvent).Msg, "禁播游戏")
+		}},
+		{"stop_live_room_list.json", func(t *testing.T, event api.Event) {
+			e := event.(*api.UnknownEvent)
+			AssertEqual(t, e.Cmd, "STOP_LIVE_ROOM_LIST")
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			msg := loadEventMessage(t, c.file)
+			event, err := DecodeEvent(msg)
+			if err != nil {
+				t.Fatalf("decode failed, err=%v", err)
+			}
+			c.check(t, event)
+		})
+	}
+}
+
+func TestDecodeEventSchemaMismatch(t *testing.T) {
+	for _, file := range []string{"danmu_msg_bad_uid.json", "send_gift_no_data.json"} {
+		t.Run(file, func(t *testing.T) {
+			_, err := DecodeEvent(loadEventMessage(t, file))
+			var schemaErr *EventSchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("expected schema error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeEventWithoutRaw(t *testing.T) {
+	msg := loadEventMessage(t, "danmu_msg.json")
+	msg.Raw = nil
+	event, err := DecodeEvent(msg)
+	if err != nil {
+		t.Fatalf("decode failed, err=%v", err)
+	}
+	AssertEqual(t, event.(*api.DanmuMsgEvent).Content, "晚上好")
+}
@@ -0,0 +1,48 @@
+package live_room
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/codec"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+)
+
+// handleFrame 处理一个完整的数据包，压缩包里可能有多条消息
+func handleFrame(room *api.LiveRoom, decoder *codec.Decoder, header api.DanmuMessageHeader, body []byte) (err error) {
+	switch header.OpCode {
+	case api.DanmuOpHeartBeatResp:
+		now := time.Now().UnixNano()
+		atomic.StoreInt64(&room.HeartBeatRespAt, now)
+		if len(body) >= 4 {
+			room.Hot = binary.BigEndian.Uint32(body)
+		}
+		if sentAt := atomic.LoadInt64(&room.HeartBeatSentAt); sentAt > 0 && now >= sentAt {
+			notifyStatus(room, &api.ConnStatus{State: api.ConnConnected, Host: room.DanmuHost, RTT: time.Duration(now - sentAt)})
+		}
+	case api.DanmuOpNormal:
+		err = decoder.Each(header.ProtoVer, body, func(msg []byte) {
+			dispatchMessage(room, msg)
+		})
+	}
+	return
+}
+
+// dispatchMessage data指向复用的缓冲，交给别的goroutine前需要复制
+func dispatchMessage(room *api.LiveRoom, data []byte) {
+	raw := make([]byte, len(data))
+	copy(raw, data)
+	danmuMessage := new(api.DanmuMessage)
+	if err := json.Unmarshal(raw, danmuMessage); err != nil {
+		logging.Errorf("unmarshal normal message error, err=%v", err)
+		return
+	}
+	danmuMessage.Raw = raw
+	if room.Recorder != nil {
+		room.Recorder.RecordMessage(danmuMessage.Cmd, raw)
+	}
+	deliverMessage(room, danmuMessage)
+}
@@ -0,0 +1,299 @@
+package live_room
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/codec"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+)
+
+type countQueue struct {
+	count int
+}
+
+func (q *countQueue) Push(msg *api.DanmuMessage) {
+	q.count++
+}
+
+func (q *countQueue) Dropped() uint64 {
+	return 0
+}
+
+// frameStream 生成一段包含批量消息包、单条消息包和心跳回复的数据
+func frameStream(batches int, protoVer api.DanmuProtol) []byte {
+	danmu := []byte(`{"cmd":"DANMU_MSG","info":[[0,1,25,16777215,1665839440612,0,0,"",0,0,0,"",0,"{}","{}",{"extra":"{}"}],"晚上好",[15363296,"测试用户",0,0,0,10000,1,"#00D1F1"],[21,"小勋章","主播",7777,1725515,"",0,1725515,1725515,1725515,3,1,15363296],[0,0,9868950,">50000",0],["",""],0,0,null,{"ts":1665839440,"ct":"1"},0,0,null,null,0,105]}`)
+	gift := []byte(`{"cmd":"SEND_GIFT","data":{"uid":15363296,"uname":"测试用户","giftName":"小花花","num":1}}`)
+	stream := bytes.Buffer{}
+	for i := 0; i < batches; i++ {
+		var messages [][]byte
+		for n := 0; n < 20; n++ {
+			messages = append(messages, danmu)
+		}
+		stream.Write(codec.PackBatch(messages, protoVer))
+		stream.Write(codec.Pack(gift, api.DanmuProtolNormal, api.DanmuOpNormal, 0))
+		stream.Write(codec.Pack([]byte{0, 0, 0, 42}, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeatResp, 0))
+	}
+	return stream.Bytes()
+}
+
+// chunkReader 每次最多返回size字节，模拟一个包被拆成多次读取
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n = r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return
+}
+
+func readFrames(room *api.LiveRoom, reader *codec.Reader, decoder *codec.Decoder) error {
+	for {
+		header, body, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = handleFrame(room, decoder, header, body); err != nil {
+			return err
+		}
+	}
+}
+
+func TestHandleFrame(t *testing.T) {
+	for _, protoVer := range []api.DanmuProtol{api.DanmuProtolNormal, api.DanmuProtolNormalZlib, api.DanmuProtolNormalBrotli} {
+		queue := new(countQueue)
+		room := &api.LiveRoom{Queue: queue}
+		stream := frameStream(3, protoVer)
+		if err := readFrames(room, codec.NewReader(&chunkReader{data: stream, size: 7}), new(codec.Decoder)); err != nil {
+			t.Fatalf("read frames failed, protover=%d, err=%v", protoVer, err)
+		}
+		AssertEqual(t, queue.count, 3*21)
+		AssertEqual(t, room.Hot, uint32(42))
+	}
+
+	stream := frameStream(1, api.DanmuProtolNormalBrotli)
+	header, err := codec.DecodeHeader(stream)
+	if err != nil {
+		t.Fatalf("decode header failed, err=%v", err)
+	}
+	legacyHeader, _ := legacyParseHeader(stream)
+	AssertEqual(t, header, *legacyHeader)
+}
+
+func TestHandleFrameRawCopy(t *testing.T) {
+	room := &api.LiveRoom{MessageChan: make(chan *api.DanmuMessage, 100)}
+	reader := codec.NewReader(bytes.NewReader(frameStream(2, api.DanmuProtolNormalBrotli)))
+	if err := readFrames(room, reader, new(codec.Decoder)); err != nil {
+		t.Fatalf("read frames failed, err=%v", err)
+	}
+	close(room.MessageChan)
+	// 缓冲复用后之前的消息内容不能被覆盖
+	for msg := range room.MessageChan {
+		var check api.DanmuMessage
+		if err := json.Unmarshal(msg.Raw, &check); err != nil || check.Cmd != msg.Cmd {
+			t.Fatalf("message raw overwritten, raw=%s", msg.Raw)
+		}
+	}
+}
+
+// legacyRead 重新设计之前processRead的读取方式
+func legacyRead(room *api.LiveRoom, r io.Reader) {
+	var notComplete []byte
+	for {
+		data := make([]byte, 64*1024)
+		n, err := r.Read(data)
+		if err != nil {
+			return
+		}
+		data = data[:n]
+		if len(notComplete) != 0 {
+			data = append(notComplete, data...)
+		}
+		dataLen := len(data)
+		if dataLen > 0 {
+			unpackLen := legacyUnpackMessage(room, data)
+			if dataLen-int(unpackLen) > 0 {
+				notComplete = data[unpackLen:]
+			} else {
+				notComplete = nil
+			}
+		}
+	}
+}
+
+// benchChunkSize 新旧两种读取都按一个以太网MTU分块，保证对比的输入一致
+// go test -bench 'Read|Header' ./internal/live_room/ 可以得到新旧实现的对比
+const benchChunkSize = 1500
+
+func BenchmarkReadLegacy(b *testing.B) {
+	stream := frameStream(100, api.DanmuProtolNormalBrotli)
+	room := &api.LiveRoom{Queue: new(countQueue)}
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacyRead(room, &chunkReader{data: stream, size: benchChunkSize})
+	}
+}
+
+func BenchmarkReadFrames(b *testing.B) {
+	stream := frameStream(100, api.DanmuProtolNormalBrotli)
+	room := &api.LiveRoom{Queue: new(countQueue)}
+	source := new(chunkReader)
+	reader := codec.NewReader(source)
+	decoder := new(codec.Decoder)
+	b.SetBytes(int64(len(stream)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		*source = chunkReader{data: stream, size: benchChunkSize}
+		reader.Reset(source)
+		readFrames(room, reader, decoder)
+	}
+}
+
+func BenchmarkParseHeaderLegacy(b *testing.B) {
+	packet := codec.Pack([]byte("{}"), api.DanmuProtolNormal, api.DanmuOpNormal, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		legacyParseHeader(packet)
+	}
+}
+
+func BenchmarkDecodeHeader(b *testing.B) {
+	packet := codec.Pack([]byte("{}"), api.DanmuProtolNormal, api.DanmuOpNormal, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		codec.DecodeHeader(packet)
+	}
+}
+
+// 下面是重新设计之前的实现，只用于对比
+
+func legacyParseHeader(data []byte) (header *api.DanmuMessageHeader, err error) {
+	if len(data) < 16 {
+		err = codec.HeaderNotCompleteErr
+		return
+	}
+	b := bytes.NewBuffer(data)
+	header = new(api.DanmuMessageHeader)
+
+	v := reflect.ValueOf(header).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		ptr := v.Field(i).Addr().Interface()
+		binary.Read(b, binary.BigEndian, ptr)
+	}
+	if header.HeaderSize != 16 ||
+		header.ProtoVer > api.DanmuProtolNormalBrotli ||
+		header.OpCode > api.DanmuOpAuthResp {
+		err = codec.InvalidHeaderErr
+		return
+	}
+	return
+}
+
+func legacyUnpackMessage(room *api.LiveRoom, data []byte) (unpack uint32) {
+	for dataLen := len(data); dataLen > 0; dataLen = len(data) {
+		header, _ := legacyParseHeader(data)
+		if header == nil || (header.Size) > uint32(dataLen) {
+			return
+		}
+		unpack += header.Size
+		rawMessage := data[header.HeaderSize:header.Size]
+		data = data[header.Size:]
+		logging.Debugf("read message, header=%+v", header)
+		var normalMessage []byte
+		switch header.ProtoVer {
+		case api.DanmuProtolNormalZlib:
+			b := bytes.NewBuffer(rawMessage)
+			if zr, err := gzip.NewReader(b); err != nil {
+				logging.Errorf("decompress gzip error, err=%v", err)
+				continue
+			} else {
+				if normalMessage, err = ioutil.ReadAll(zr); err != nil {
+					logging.Errorf("decompress gzip error, err=%v", err)
+					continue
+				}
+			}
+		case api.DanmuProtolNormalBrotli:
+			b := bytes.NewBuffer(rawMessage)
+			br := brotli.NewReader(b)
+			var err error
+			if normalMessage, err = ioutil.ReadAll(br); err != nil {
+				logging.Errorf("decompress brotli error, err=%v", err)
+				continue
+			}
+		default:
+			normalMessage = rawMessage
+		}
+		logging.Debugf("read message, header=%+v", header)
+		switch header.OpCode {
+		case api.DanmuOpHeartBeatResp:
+			atomic.StoreInt64(&room.HeartBeatRespAt, time.Now().UnixNano())
+			if len(normalMessage) >= 4 {
+				room.Hot = binary.BigEndian.Uint32(normalMessage)
+			}
+		case api.DanmuOpNormal:
+			if header.ProtoVer == api.DanmuProtolNormal {
+				danmuMessage := new(api.DanmuMessage)
+				if err := json.Unmarshal(normalMessage, danmuMessage); err != nil {
+					logging.Errorf("unmarshal normal message error, err=%v", err)
+					continue
+				}
+				danmuMessage.Raw = normalMessage
+				if room.Recorder != nil {
+					room.Recorder.RecordMessage(danmuMessage.Cmd, normalMessage)
+				}
+				deliverMessage(room, danmuMessage)
+			} else if header.ProtoVer == api.DanmuProtolNormalZlib || header.ProtoVer == api.DanmuProtolNormalBrotli {
+				for messagesLen := len(normalMessage); messagesLen > 0; messagesLen = len(normalMessage) {
+					messageHeader, err := legacyParseHeader(normalMessage)
+					if err != nil {
+						logging.Errorf("parse message error, err=%v", err)
+						break
+					} else if messageHeader.Size > uint32(messagesLen) {
+						logging.Errorf("header message size overflow")
+						break
+					}
+					oneNormalMessage := normalMessage[messageHeader.HeaderSize:messageHeader.Size]
+					normalMessage = normalMessage[messageHeader.Size:]
+					danmuMessage := new(api.DanmuMessage)
+					if err := json.Unmarshal(oneNormalMessage, danmuMessage); err != nil {
+						logging.Errorf("unmarshal normal message error, err=%v", err)
+						continue
+					}
+					danmuMessage.Raw = oneNormalMessage
+					if room.Recorder != nil {
+						room.Recorder.RecordMessage(danmuMessage.Cmd, oneNormalMessage)
+					}
+					deliverMessage(room, danmuMessage)
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-querystring/query"
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var GiftNumErr = errors.New("gift num must be positive")
+
+func GetGiftConfig(ctx context.Context, client *api.Client, roomID uint64) (resp *api.GiftConfigResp, err error) {
+	req := api.GiftConfigReq{Platform: "pc", RoomID: roomID}
+	resp = new(api.GiftConfigResp)
+	err = client.Get(ctx, client.BaseURLs.Live+"/xlive/web-room/v1/giftPanel/giftConfig", req, resp)
+	return
+}
+
+// GetBagList 包裹里的礼物，需要登录
+func GetBagList(ctx context.Context, client *api.Client, roomID uint64) (resp *api.BagListResp, err error) {
+	req := api.BagListReq{RoomID: roomID, T: time.Now().UnixMilli()}
+	resp = new(api.BagListResp)
+	err = client.Get(ctx, client.BaseURLs.Live+"/xlive/web-room/v1/gift/bag_list", req, resp)
+	return
+}
+
+func GetWallet(ctx context.Context, client *api.Client) (resp *api.WalletResp, err error) {
+	req := api.WalletReq{NeedBp: 1, NeedMetal: 1, Platform: "pc"}
+	resp = new(api.WalletResp)
+	err = client.Get(ctx, client.BaseURLs.Live+"/xlive/revenue/v1/wallet/myWallet", req, resp)
+	return
+}
+
+// SendGift 用金瓜子或银瓜子赠送礼物给主播
+func SendGift(ctx context.Context, room *api.LiveRoom, gift *api.GiftConfig, num int) (err error) {
+	req := newSendGiftReq(room, gift.ID, num)
+	req.CoinType = gift.CoinType
+	req.Price = gift.Price
+	path := "/xlive/revenue/v1/gift/sendGold"
+	if gift.CoinType == api.CoinTypeSilver {
+		path = "/xlive/revenue/v1/gift/sendSilver"
+	}
+	return postSendGift(ctx, room.Client, path, req)
+}
+
+// SendBagGift 赠送包裹里的礼物，不花钱
+func SendBagGift(ctx context.Context, room *api.LiveRoom, gift *api.BagGift, num int) (err error) {
+	req := newSendGiftReq(room, gift.GiftID, num)
+	req.CoinType = api.CoinTypeSilver
+	req.BagID = gift.BagID
+	return postSendGift(ctx, room.Client, "/xlive/revenue/v1/gift/sendBag", req)
+}
+
+func newSendGiftReq(room *api.LiveRoom, giftID int64, num int) *api.SendGiftReq {
+	return &api.SendGiftReq{
+		UID:       room.UID,
+		GiftID:    giftID,
+		Ruid:      room.OwnerId,
+		GiftNum:   num,
+		Platform:  "pc",
+		BizCode:   "Live",
+		BizID:     room.RoomID,
+		Rnd:       time.Now().Unix(),
+		CSRF:      room.CSRF,
+		CSRFToken: room.CSRF,
+	}
+}
+
+func postSendGift(ctx context.Context, client *api.Client, path string, req *api.SendGiftReq) (err error) {
+	if req.GiftNum <= 0 {
+		return GiftNumErr
+	}
+	form, err := query.Values(req)
+	if err != nil {
+		return
+	}
+	return client.PostForm(ctx, client.BaseURLs.Live+path, form, nil)
+}
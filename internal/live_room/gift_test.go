@@ -0,0 +1,65 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func TestSendGift(t *testing.T) {
+	server := startMockServer(t)
+	room := loginAndConnect(t, server)
+	client := room.Client
+
+	config, err := GetGiftConfig(context.Background(), client, room.RoomID)
+	if err != nil {
+		t.Fatalf("get gift config failed, err=%v", err)
+	}
+	gift := config.Data.List[0]
+	AssertEqual(t, gift.CoinType, api.CoinTypeGold)
+	if err = SendGift(context.Background(), room, &gift, 3); err != nil {
+		t.Fatalf("send gift failed, err=%v", err)
+	}
+	wallet, err := GetWallet(context.Background(), client)
+	if err != nil {
+		t.Fatalf("get wallet failed, err=%v", err)
+	}
+	AssertEqual(t, wallet.Data.Gold, int64(mock_server.MockGold)-3*gift.Price)
+
+	select {
+	case msg := <-room.MessageChan:
+		event, err := DecodeEvent(msg)
+		if err != nil {
+			t.Fatalf("decode event failed, err=%v", err)
+		}
+		e := event.(*api.SendGiftEvent)
+		AssertEqual(t, e.UID, uint64(mock_server.MockUID))
+		AssertEqual(t, e.GiftName, gift.Name)
+		AssertEqual(t, e.Num, 3)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SEND_GIFT not received")
+	}
+
+	bag, err := GetBagList(context.Background(), client, room.RoomID)
+	if err != nil {
+		t.Fatalf("get bag failed, err=%v", err)
+	}
+	item := bag.Data.List[0]
+	if err = SendBagGift(context.Background(), room, &item, item.GiftNum+1); !api.IsCode(err, mock_server.CodeGiftNotEnough) {
+		t.Errorf("send more than bag has, err=%v", err)
+	}
+	if err = SendBagGift(context.Background(), room, &item, 0); !errors.Is(err, GiftNumErr) {
+		t.Errorf("send zero gift, err=%v", err)
+	}
+	if err = SendBagGift(context.Background(), room, &item, item.GiftNum); err != nil {
+		t.Errorf("send bag gift failed, err=%v", err)
+	}
+	// 余额不够时不会扣钱
+	if err = SendGift(context.Background(), room, &gift, mock_server.MockGold); err == nil {
+		t.Errorf("send gift without enough gold should fail")
+	}
+}
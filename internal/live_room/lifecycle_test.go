@@ -0,0 +1,160 @@
+package live_room
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+// checkGoroutineLeak 等待协程数回到baseline，超时后打印所有协程的调用栈
+func checkGoroutineLeak(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("goroutine leak, baseline=%d, now=%d\n%s", baseline, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitClosed MessageChan应该在房间关闭后被关闭
+func waitClosed(t *testing.T, room *api.LiveRoom) {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case _, ok := <-room.MessageChan:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("message chan not closed")
+		}
+	}
+}
+
+// waitStatus 跳过其他状态，等到指定的连接状态
+func waitStatus(t *testing.T, room *api.LiveRoom, state api.ConnState) *api.ConnStatus {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case status := <-room.StatusChan:
+			if status.State == state {
+				return status
+			}
+		case <-timeout:
+			t.Fatalf("conn state %v not reached", state)
+		}
+	}
+}
+
+func TestRoomClose(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+	baseline := runtime.NumGoroutine()
+
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	waitConnected(t, server)
+	server.PushDanmu(1, "tester", "hello")
+	select {
+	case msg := <-room.MessageChan:
+		AssertEqual(t, msg.Cmd, api.CmdDanmuMsg)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no message received")
+	}
+
+	if err = room.Close(); err != nil {
+		t.Errorf("close failed, err=%v", err)
+	}
+	room.Close()
+	waitClosed(t, room)
+	if room.Go(func() {}) {
+		t.Errorf("closed room should not start goroutine")
+	}
+	client.HTTP.CloseIdleConnections()
+	checkGoroutineLeak(t, baseline)
+	// 服务端读到EOF后才移除连接
+	for deadline := time.Now().Add(time.Second); server.ConnCount() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	AssertEqual(t, server.ConnCount(), 0)
+}
+
+func TestRoomContextCancel(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	room, err := AuthAndConnect(ctx, client, &api.BiliLiveConfig{RoomID: 7777})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	cancel()
+	room.Wait()
+	waitClosed(t, room)
+	client.HTTP.CloseIdleConnections()
+	checkGoroutineLeak(t, baseline)
+}
+
+func TestRoomCloseDuringReconnect(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+	baseline := runtime.NumGoroutine()
+
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777, MaxReconnect: 3})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	waitConnected(t, server)
+	server.CloseConns()
+	status := waitStatus(t, room, api.ConnReconnecting)
+	AssertEqual(t, status.Attempt, 1)
+	// 正在等待重连时关闭，不应该等到重连结束
+	start := time.Now()
+	room.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close blocked by reconnect for %v", elapsed)
+	}
+	waitClosed(t, room)
+	client.HTTP.CloseIdleConnections()
+	checkGoroutineLeak(t, baseline)
+}
+
+func TestRoomGiveUp(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777, MaxReconnect: 1})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	waitConnected(t, server)
+	server.Close()
+	// 重连放弃后房间自己关闭
+	done := make(chan struct{})
+	go func() {
+		room.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("room not closed after give up")
+	}
+	waitClosed(t, room)
+}
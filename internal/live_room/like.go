@@ -0,0 +1,44 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/go-querystring/query"
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+// MaxLikeBatch 一次上报最多的点赞次数
+const MaxLikeBatch = 100
+
+var LikeCountErr = errors.New("like count out of range")
+
+// SendLike 上报点赞，连续点击时合并成一次请求，count为这一批的点击次数
+func SendLike(ctx context.Context, room *api.LiveRoom, count int) (err error) {
+	if count <= 0 || count > MaxLikeBatch {
+		return LikeCountErr
+	}
+	req := api.LikeReportReq{
+		ClickTime: count,
+		RoomID:    room.RoomID,
+		UID:       room.UID,
+		AnchorID:  room.OwnerId,
+		CSRF:      room.CSRF,
+		CSRFToken: room.CSRF,
+	}
+	form, err := query.Values(req)
+	if err != nil {
+		return
+	}
+	return room.Client.PostForm(ctx, room.Client.BaseURLs.Live+"/xlive/app-ucenter/v1/like_info_v3/like/likeReportV3", form, nil)
+}
+
+// GetLikeCount 房间当前的点赞总数，之后的变化通过LIKE_INFO_V3_UPDATE推送
+func GetLikeCount(ctx context.Context, client *api.Client, roomID uint64) (count int64, err error) {
+	info := new(api.RoomLikeInfoResp)
+	err = client.GetSigned(ctx, client.BaseURLs.Live+"/xlive/web-room/v1/index/getInfoByRoom", api.RoomInfoReq{RoomID: roomID}, info)
+	if err != nil {
+		return
+	}
+	return info.Data.LikeInfoV3.TotalLikes, nil
+}
@@ -0,0 +1,48 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func TestSendLike(t *testing.T) {
+	server := startMockServer(t)
+	room := loginAndConnect(t, server)
+	count, err := GetLikeCount(context.Background(), room.Client, room.RoomID)
+	if err != nil {
+		t.Fatalf("get like count failed, err=%v", err)
+	}
+	AssertEqual(t, count, int64(mock_server.MockLikes))
+
+	if err := SendLike(context.Background(), room, 0); !errors.Is(err, LikeCountErr) {
+		t.Errorf("send zero like, err=%v", err)
+	}
+	if err := SendLike(context.Background(), room, MaxLikeBatch+1); !errors.Is(err, LikeCountErr) {
+		t.Errorf("send too many likes, err=%v", err)
+	}
+	for _, count := range []int{5, 3} {
+		if err := SendLike(context.Background(), room, count); err != nil {
+			t.Fatalf("send like failed, err=%v", err)
+		}
+	}
+	AssertEqual(t, server.Likes(), int64(mock_server.MockLikes+8))
+
+	var last int64
+	for last != mock_server.MockLikes+8 {
+		select {
+		case msg := <-room.MessageChan:
+			event, err := DecodeEvent(msg)
+			if err != nil {
+				t.Fatalf("decode event failed, err=%v", err)
+			}
+			last = event.(*api.LikeInfoUpdateEvent).ClickCount
+		case <-time.After(5 * time.Second):
+			t.Fatalf("LIKE_INFO_V3_UPDATE not received, last=%d", last)
+		}
+	}
+}
@@ -1,370 +1,339 @@
 package live_room
 
 import (
-	"bytes"
-	"compress/gzip"
-	"compress/zlib"
 	"container/list"
-	"encoding/binary"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/andybalholm/brotli"
-	"github.com/google/go-querystring/query"
 	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/codec"
+	"github.com/shr-go/bili_live_tui/internal/proxy"
+	"github.com/shr-go/bili_live_tui/internal/record"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
-	"io"
-	"io/ioutil"
 	"net"
-	"net/http"
-	"reflect"
+	"net/url"
 	"strconv"
 	"sync/atomic"
 	"time"
 )
 
 var (
-	invalidMessageErr    = errors.New("message invalid")
-	headerNotCompleteErr = errors.New("header not complete")
+	noServerErr  = errors.New("no server can connect")
+	danmuAuthErr = errors.New("connect server auth failed")
 )
 
-func packMessage(data []byte, protoVer api.DanmuProtol, protoOp api.DanmuOp, seq uint32) []byte {
-	b := bytes.Buffer{}
-	length := uint32(16 + len(data))
-	binary.Write(&b, binary.BigEndian, length)
-	binary.Write(&b, binary.BigEndian, uint16(16))
-	binary.Write(&b, binary.BigEndian, uint16(protoVer))
-	binary.Write(&b, binary.BigEndian, uint32(protoOp))
-	binary.Write(&b, binary.BigEndian, seq)
+func GetDanmuInfo(ctx context.Context, client *api.Client, id uint64) (info *api.DanmuInfoResp, err error) {
+	danmuInfoReq := api.DanmuInfoReq{ID: id}
+	info = new(api.DanmuInfoResp)
+	err = client.GetSigned(ctx, client.BaseURLs.Live+"/xlive/web-room/v1/index/getDanmuInfo", danmuInfoReq, info)
+	return
+}
 
-	if len(data) > 0 {
-		switch protoVer {
-		case api.DanmuProtolNormalZlib:
-			w := zlib.NewWriter(&b)
-			w.Write(data)
-			w.Close()
-		case api.DanmuProtolNormalBrotli:
-			w := brotli.NewWriter(&b)
-			w.Write(data)
-			w.Close()
-		default:
-			b.Write(data)
-		}
+func danmuTransports(config *api.BiliLiveConfig) []api.DanmuTransport {
+	transport := api.DanmuTransportAuto
+	if config != nil && config.DanmuTransport != "" {
+		transport = config.DanmuTransport
+	}
+	switch transport {
+	case api.DanmuTransportTCP, api.DanmuTransportWSS, api.DanmuTransportWS:
+		return []api.DanmuTransport{transport}
+	default:
+		return []api.DanmuTransport{api.DanmuTransportTCP, api.DanmuTransportWSS, api.DanmuTransportWS}
 	}
-	return b.Bytes()
 }
 
-func parseHeader(data []byte) (header *api.DanmuMessageHeader, err error) {
-	if len(data) < 16 {
-		err = headerNotCompleteErr
-		return
+// danmuProtoVer 认证时请求的协议版本，决定服务器推送的消息是否压缩以及用什么算法
+func danmuProtoVer(config *api.BiliLiveConfig) api.DanmuProtol {
+	if config == nil || config.ProtoVer == nil {
+		return api.DanmuProtolNormalBrotli
 	}
-	b := bytes.NewBuffer(data)
-	header = new(api.DanmuMessageHeader)
-
-	v := reflect.ValueOf(header).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		ptr := v.Field(i).Addr().Interface()
-		binary.Read(b, binary.BigEndian, ptr)
+	if !codec.Supported(*config.ProtoVer) {
+		logging.Warnf("unsupported protover %d, use %d", *config.ProtoVer, api.DanmuProtolNormalBrotli)
+		return api.DanmuProtolNormalBrotli
 	}
-	if header.HeaderSize != 16 ||
-		header.ProtoVer > api.DanmuProtolNormalBrotli ||
-		header.OpCode > api.DanmuOpAuthResp {
-		err = invalidMessageErr
+	return *config.ProtoVer
+}
+
+// proxyDialer 弹幕连接和接口请求使用同一套代理设置，没有配置代理时返回nil直连
+func proxyDialer(config *api.BiliLiveConfig) (dialer *proxy.Dialer, err error) {
+	if config == nil {
 		return
 	}
-	return
+	return proxy.New(config.Proxy, config.NoProxy)
 }
 
-func unpackMessage(room *api.LiveRoom, data []byte) (unpack uint32) {
-	for dataLen := len(data); dataLen > 0; dataLen = len(data) {
-		header, _ := parseHeader(data)
-		if header == nil || (header.Size) > uint32(dataLen) {
-			return
-		}
-		unpack += header.Size
-		rawMessage := data[header.HeaderSize:header.Size]
-		data = data[header.Size:]
-		logging.Debugf("read message, header=%+v", header)
-		var normalMessage []byte
-		switch header.ProtoVer {
-		case api.DanmuProtolNormalZlib:
-			b := bytes.NewBuffer(rawMessage)
-			if zr, err := gzip.NewReader(b); err != nil {
-				logging.Errorf("decompress gzip error, err=%v", err)
-				continue
-			} else {
-				if normalMessage, err = ioutil.ReadAll(zr); err != nil {
-					logging.Errorf("decompress gzip error, err=%v", err)
-					continue
-				}
-			}
-		case api.DanmuProtolNormalBrotli:
-			b := bytes.NewBuffer(rawMessage)
-			br := brotli.NewReader(b)
-			var err error
-			if normalMessage, err = ioutil.ReadAll(br); err != nil {
-				logging.Errorf("decompress brotli error, err=%v", err)
-				continue
-			}
-		default:
-			normalMessage = rawMessage
-		}
-		logging.Debugf("read message, header=%+v", header)
-		switch header.OpCode {
-		case api.DanmuOpHeartBeatResp:
-			if len(normalMessage) >= 4 {
-				room.Hot = binary.BigEndian.Uint32(normalMessage)
-			}
-		case api.DanmuOpNormal:
-			if header.ProtoVer == api.DanmuProtolNormal {
-				danmuMessage := new(api.DanmuMessage)
-				if err := json.Unmarshal(normalMessage, danmuMessage); err != nil {
-					logging.Errorf("unmarshal normal message error, err=%v", err)
-					continue
-				}
-				room.MessageChan <- danmuMessage
-			} else if header.ProtoVer == api.DanmuProtolNormalZlib || header.ProtoVer == api.DanmuProtolNormalBrotli {
-				for messagesLen := len(normalMessage); messagesLen > 0; messagesLen = len(normalMessage) {
-					messageHeader, err := parseHeader(normalMessage)
-					if err != nil {
-						logging.Errorf("parse message error, err=%v", err)
-						break
-					} else if messageHeader.Size > uint32(messagesLen) {
-						logging.Errorf("header message size overflow")
-						break
-					}
-					oneNormalMessage := normalMessage[messageHeader.HeaderSize:messageHeader.Size]
-					normalMessage = normalMessage[messageHeader.Size:]
-					danmuMessage := new(api.DanmuMessage)
-					if err := json.Unmarshal(oneNormalMessage, danmuMessage); err != nil {
-						logging.Errorf("unmarshal normal message error, err=%v", err)
-						continue
-					}
-					room.MessageChan <- danmuMessage
-				}
-			}
-		}
+func dialDanmuHost(host api.DanmuHost, transport api.DanmuTransport, dialer *proxy.Dialer) (conn net.Conn, err error) {
+	switch transport {
+	case api.DanmuTransportWSS:
+		u := url.URL{Scheme: "wss", Host: net.JoinHostPort(host.Host, strconv.Itoa(host.WssPort)), Path: "/sub"}
+		return dialWebsocket(u.String(), dialTimeout, dialer)
+	case api.DanmuTransportWS:
+		u := url.URL{Scheme: "ws", Host: net.JoinHostPort(host.Host, strconv.Itoa(host.WsPort)), Path: "/sub"}
+		return dialWebsocket(u.String(), dialTimeout, dialer)
+	default:
+		return dialer.Dial("tcp", net.JoinHostPort(host.Host, strconv.Itoa(host.Port)), dialTimeout)
 	}
-	return
 }
 
-func GetDanmuInfo(client *http.Client, id uint64) (info *api.DanmuInfoResp, err error) {
-	danmuInfoReq := api.DanmuInfoReq{ID: id}
-	v, err := query.Values(danmuInfoReq)
-	if err != nil {
-		return
-	}
-	baseURL := "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo"
-	realUrl := fmt.Sprintf("%s?%s", baseURL, v.Encode())
-	resp, err := client.Get(realUrl)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
-	danmuInfoResp := new(api.DanmuInfoResp)
-	err = json.Unmarshal(body, danmuInfoResp)
-	if err != nil {
-		return
-	}
-	if danmuInfoResp.Code != 0 {
-		err = errors.New(danmuInfoResp.Message)
-	}
-	info = danmuInfoResp
-	return
+func connectDanmuServer(uid uint64, buvid string, roomID uint64, info *api.DanmuInfoResp, config *api.BiliLiveConfig, dialer *proxy.Dialer) (conn net.Conn, addr string, err error) {
+	return connectDanmuHosts(uid, buvid, roomID, info.Data.Token, info.Data.HostList, config, dialer)
 }
 
-func connectDanmuServer(uid uint64, roomID uint64, info *api.DanmuInfoResp) (conn net.Conn, err error) {
-	for _, HostData := range info.Data.HostList {
-		timeout := time.Second
-		conn, err = net.DialTimeout("tcp", net.JoinHostPort(HostData.Host, strconv.Itoa(HostData.Port)), timeout)
-		if err == nil && conn != nil {
-			break
+// connectDanmuHosts 按顺序尝试hosts，拨通第一个后用token完成认证，addr是实际连上的地址
+func connectDanmuHosts(uid uint64, buvid string, roomID uint64, token string, hosts []api.DanmuHost, config *api.BiliLiveConfig, dialer *proxy.Dialer) (conn net.Conn, addr string, err error) {
+Dial:
+	for _, transport := range danmuTransports(config) {
+		for _, HostData := range hosts {
+			conn, err = dialDanmuHost(HostData, transport, dialer)
+			if err == nil && conn != nil {
+				logging.Infof("connect danmu server, host=%s, transport=%s, proxy=%s", HostData.Host, transport, dialer)
+				addr = fmt.Sprintf("%s://%s", transport, HostData.Host)
+				break Dial
+			}
+			logging.Warnf("dial danmu server failed, host=%s, transport=%s, err=%v", HostData.Host, transport, err)
 		}
 	}
 	if conn == nil {
-		return nil, errors.New("no server can connect")
+		return nil, "", noServerErr
 	}
 	danmuAuthPacketReq := api.DanmuAuthPacketReq{
 		UID:      uid,
 		RoomID:   roomID,
-		ProtoVer: 3,
+		ProtoVer: uint8(danmuProtoVer(config)),
+		Buvid:    buvid,
 		Platform: "web",
 		Type:     2,
-		Key:      info.Data.Token,
+		Key:      token,
 	}
 	jsonReq, err := json.Marshal(danmuAuthPacketReq)
 	if err != nil {
-		return
+		conn.Close()
+		return nil, "", err
 	}
-	data := packMessage(jsonReq, api.DanmuProtolHeartBeat, api.DanmuOpAuth, 1)
+	data := codec.Pack(jsonReq, api.DanmuProtolHeartBeat, api.DanmuOpAuth, 1)
 	dataLen := len(data)
+	// 服务器不回复认证时不能一直等下去，否则房间关闭时重连协程无法退出
+	conn.SetDeadline(time.Now().Add(authTimeout))
+	defer conn.SetDeadline(time.Time{})
 	n, err := conn.Write(data)
-	if err != nil {
-		return
-	} else if n != dataLen {
+	if err == nil && n != dataLen {
 		err = errors.New("connect server failed")
-		return
+	}
+	if err != nil {
+		conn.Close()
+		return nil, "", err
 	}
 	resp := make([]byte, 8192)
 	n, err = conn.Read(resp)
 	if err != nil {
-		return
+		conn.Close()
+		return nil, "", err
 	}
-	danmuHeader, _ := parseHeader(resp)
-	if danmuHeader == nil {
-		err = errors.New("parse header failed")
-		return
+	danmuHeader, err := codec.DecodeHeader(resp[:n])
+	if err != nil {
+		conn.Close()
+		return nil, "", errors.New("parse header failed")
 	}
 	danmuAuthPacketResp := api.DanmuAuthPacketResp{}
 	err = json.Unmarshal(resp[danmuHeader.HeaderSize:n], &danmuAuthPacketResp)
 	if err != nil || danmuAuthPacketResp.Code != 0 {
-		err = errors.New("connect server auth failed")
+		conn.Close()
+		return nil, "", danmuAuthErr
+	}
+	return
+}
+
+func ConnectDanmuServer(ctx context.Context, uid uint64, buvid string, roomID uint64, info *api.DanmuInfoResp, config *api.BiliLiveConfig) (room *api.LiveRoom, err error) {
+	room, start, err := dialDanmuServer(ctx, uid, buvid, roomID, info, config)
+	if err != nil {
 		return
 	}
+	start()
 	return
 }
 
-func ConnectDanmuServer(uid uint64, roomID uint64, info *api.DanmuInfoResp) (room *api.LiveRoom, err error) {
-	conn, err := connectDanmuServer(uid, roomID, info)
+// dialDanmuServer 只建立连接，调用方填好房间信息后再调用start启动读写协程，
+// 避免重连时读到还没设置的Client
+func dialDanmuServer(ctx context.Context, uid uint64, buvid string, roomID uint64, info *api.DanmuInfoResp, config *api.BiliLiveConfig) (room *api.LiveRoom, start func(), err error) {
+	// 代理只解析一次，重连时继续使用
+	dialer, err := proxyDialer(config)
+	if err != nil {
+		return
+	}
+	conn, addr, err := connectDanmuServer(uid, buvid, roomID, info, config, dialer)
 	if err != nil {
 		return
 	}
+	queue := newMessageQueue(config)
 	room = &api.LiveRoom{
 		UID:         uid,
+		Buvid:       buvid,
 		RoomID:      roomID,
 		Hot:         0,
 		Seq:         1,
 		MessageChan: make(chan *api.DanmuMessage, 10),
 		ReqChan:     make(chan []byte, 10),
-		DoneChan:    make(chan struct{}),
 		RetryChan:   make(chan struct{}),
+		StatusChan:  make(chan *api.ConnStatus, 10),
 		StreamConn:  conn,
+		DanmuHost:   addr,
+		Config:      config,
+		Recorder:    newRecorder(config),
+		Queue:       queue,
+		Bus:         NewRoomBus(),
+	}
+	start = func() {
+		notifyStatus(room, &api.ConnStatus{State: api.ConnConnected, Host: addr})
+		room.Start(ctx)
+		room.Go(func() { queue.forward(room.MessageChan, room.DoneChan) })
+		room.Go(func() { processWrite(room) })
+		room.Go(func() { processRead(room) })
+		room.Go(func() { monitorConn(room, dialer) })
 	}
+	return
+}
+
+const (
+	defaultHeartBeatInterval  = 30 * time.Second
+	defaultHeartBeatMaxMissed = 3
+	writeTimeout              = 10 * time.Second
+	authTimeout               = 5 * time.Second
+	// dialTimeout 每次拨号的超时，包括代理和websocket的握手
+	dialTimeout = 3 * time.Second
+)
 
-	// process write
-	go processWrite(room)
+func heartBeatInterval(config *api.BiliLiveConfig) time.Duration {
+	if config != nil && config.HeartBeatInterval > 0 {
+		return time.Duration(config.HeartBeatInterval) * time.Second
+	}
+	return defaultHeartBeatInterval
+}
 
-	// process read
-	go processRead(room)
+// heartBeatTimeout 连续这么久没有收到心跳回复就认为连接已经失效
+func heartBeatTimeout(config *api.BiliLiveConfig) time.Duration {
+	maxMissed := defaultHeartBeatMaxMissed
+	if config != nil && config.HeartBeatMaxMissed > 0 {
+		maxMissed = config.HeartBeatMaxMissed
+	}
+	return time.Duration(maxMissed) * heartBeatInterval(config)
+}
 
-	go monitorConn(room)
+const defaultRecordFile = "record/danmu.rec"
 
-	return
+func newRecorder(config *api.BiliLiveConfig) api.MessageRecorder {
+	if config == nil || !config.Record {
+		return nil
+	}
+	fileName := config.RecordFile
+	if fileName == "" {
+		fileName = defaultRecordFile
+	}
+	logging.Infof("record danmu stream to %s", fileName)
+	return record.NewRecorder(record.Options{
+		FileName:     fileName,
+		MaxSize:      config.RecordMaxSize,
+		RotateOnLive: config.RecordRotateOnLive,
+	})
 }
 
-func heartBeatReq(room *api.LiveRoom) {
+func heartBeatPacket(room *api.LiveRoom) []byte {
 	body, _ := hex.DecodeString("5b6f626a656374204f626a6563745d")
 	seq := atomic.AddUint32(&room.Seq, 1)
-	data := packMessage(body, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeat, seq)
-	room.ReqChan <- data
+	return codec.Pack(body, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeat, seq)
 }
 
+// processWrite 心跳由写协程自己发送，不经过ReqChan，避免ReqChan满时阻塞自己
 func processWrite(room *api.LiveRoom) {
-	heartBeatReq(room)
-	heartBeatTicker := time.NewTicker(30 * time.Second)
+	atomic.StoreInt64(&room.HeartBeatRespAt, time.Now().UnixNano())
+	heartBeatTicker := time.NewTicker(heartBeatInterval(room.Config))
 	defer heartBeatTicker.Stop()
+	timeout := heartBeatTimeout(room.Config)
 	dataList := list.New()
-	doneChan := room.DoneChan
+	conn := room.StreamConn
+	retryChan := room.RetryChan
+	write := func(data []byte) bool {
+		for dataList.Len() > 0 {
+			preData := dataList.Front().Value.([]byte)
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := conn.Write(preData); err != nil {
+				logging.Errorf("connection close from write, err=%v", err)
+				// 关闭连接让读协程报错，由monitorConn统一重连
+				conn.Close()
+				return false
+			}
+			dataList.Remove(dataList.Front())
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(data); err != nil {
+			dataList.PushBack(data)
+		}
+		return true
+	}
+	sendHeartBeat := func() bool {
+		atomic.StoreInt64(&room.HeartBeatSentAt, time.Now().UnixNano())
+		return write(heartBeatPacket(room))
+	}
+	if !sendHeartBeat() {
+		return
+	}
 Loop:
 	for {
 		select {
-		case <-doneChan:
+		case <-room.DoneChan:
+			break Loop
+		case <-retryChan:
 			break Loop
 		case <-heartBeatTicker.C:
-			heartBeatReq(room)
-		case data := <-room.ReqChan:
-			for dataList.Len() > 0 {
-				preData := dataList.Front().Value.([]byte)
-				// todo Add timeout settings
-				if _, err := room.StreamConn.Write(preData); err != nil {
-					if err != nil {
-						logging.Errorf("connection close from write, err=%v", err)
-						break Loop
-					}
-				} else {
-					dataList.Remove(dataList.Front())
-				}
+			lastResp := time.Unix(0, atomic.LoadInt64(&room.HeartBeatRespAt))
+			if since := time.Since(lastResp); since > timeout {
+				// 半开连接不会报错，只能靠心跳回复判断，关闭连接后读协程会触发重连
+				logging.Errorf("heart beat resp missing for %v, close connection", since)
+				conn.Close()
+				break Loop
+			}
+			if !sendHeartBeat() {
+				break Loop
 			}
-			if dataList.Len() == 0 {
-				_, err := room.StreamConn.Write(data)
-				if err == nil {
-					continue
-				}
+		case data := <-room.ReqChan:
+			if !write(data) {
+				break Loop
 			}
-			dataList.PushBack(data)
 		}
 	}
 	logging.Infof("write goroutine quit")
 }
 
 func processRead(room *api.LiveRoom) {
-	var notComplete []byte
-	doneChan := room.DoneChan
+	conn := room.StreamConn
+	retryChan := room.RetryChan
+	// 心跳回复每个周期都会有，超过这个时间什么都读不到说明连接已经断了
+	readTimeout := heartBeatTimeout(room.Config) + heartBeatInterval(room.Config)
+	reader := codec.NewReader(conn)
+	decoder := new(codec.Decoder)
 Loop:
 	for {
 		select {
-		case <-doneChan:
+		case <-room.DoneChan:
 			break Loop
 		default:
-			data := make([]byte, 64*1024)
-			// todo Add timeout settings
-			n, err := room.StreamConn.Read(data)
+			conn.SetReadDeadline(time.Now().Add(readTimeout))
+			header, body, err := reader.Next()
 			if err != nil {
-				close(room.RetryChan)
+				notifyStatus(room, &api.ConnStatus{State: api.ConnDisconnected, Host: room.DanmuHost, Err: err})
+				close(retryChan)
 				logging.Errorf("connection close from read, err=%v", err)
 				break Loop
 			}
-			data = data[:n]
-			if len(notComplete) != 0 {
-				data = append(notComplete, data...)
+			if room.Recorder != nil {
+				room.Recorder.RecordRaw(reader.Raw())
 			}
-			dataLen := len(data)
-			if dataLen > 0 {
-				unpackLen := unpackMessage(room, data)
-				leftLen := dataLen - int(unpackLen)
-				if leftLen > 0 {
-					notComplete = data[unpackLen:]
-				} else {
-					notComplete = nil
-				}
+			logging.Debugf("read message, header=%+v", header)
+			if err = handleFrame(room, decoder, header, body); err != nil {
+				logging.Errorf("handle message error, header=%+v, err=%v", header, err)
 			}
 		}
 	}
 	logging.Infof("read goroutine quit")
 }
-
-func monitorConn(room *api.LiveRoom) {
-Loop:
-	for {
-		select {
-		case <-room.DoneChan:
-			break Loop
-		case <-room.RetryChan:
-			logging.Infof("retry connect danmu server")
-			close(room.DoneChan)
-			client := room.Client
-			realRoomID := room.RoomID
-			info, err := GetDanmuInfo(client, realRoomID)
-			if err != nil {
-				logging.Fatalf("retry get danmu info failed, err=%v", err)
-			}
-			conn, err := connectDanmuServer(room.UID, realRoomID, info)
-			if err != nil {
-				logging.Fatalf("retry connect danmu server failed, err=%v", err)
-			}
-			logging.Infof("retry connect danmu server success")
-			room.StreamConn = conn
-			room.DoneChan = make(chan struct{})
-			room.RetryChan = make(chan struct{})
-			go processWrite(room)
-			go processRead(room)
-		}
-	}
-	logging.Infof("monitor goroutine quit")
-}
@@ -1,13 +1,27 @@
 package live_room
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"net"
 	"net/http"
+	"os"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+	"go.uber.org/zap"
 )
 
+func TestMain(m *testing.M) {
+	logging.SetDefaultLogger(zap.NewNop().Sugar())
+	os.Exit(m.Run())
+}
+
 func AssertEqual(t *testing.T, a interface{}, b interface{}) {
 	if a == b {
 		return
@@ -15,27 +29,75 @@ func AssertEqual(t *testing.T, a interface{}, b interface{}) {
 	t.Errorf("Received %v (type %v), expected %v (type %v)", a, reflect.TypeOf(a), b, reflect.TypeOf(b))
 }
 
+func startMockServer(t *testing.T) *mock_server.Server {
+	server, err := mock_server.Start()
+	if err != nil {
+		t.Fatalf("start mock server failed, err=%v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// waitConnected 等到模拟服务器收到弹幕连接，连不上时测试失败而不是一直等
+func waitConnected(t *testing.T, server *mock_server.Server) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); server.ConnCount() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("danmu connection not established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// loginAndConnect 用模拟账号登录后进入模拟服务器的房间，弹幕连接建立后返回
+func loginAndConnect(t *testing.T, server *mock_server.Server) *api.LiveRoom {
+	t.Helper()
+	client := newClient(server)
+	t.Cleanup(client.HTTP.CloseIdleConnections)
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: server.RoomID})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v\n", err)
+	}
+	t.Cleanup(func() { room.Close() })
+	waitConnected(t, server)
+	return room
+}
+
+func newClient(server *mock_server.Server) *api.Client {
+	client := api.NewClient(&http.Client{}, server.BaseURLs())
+	UseWbi(client)
+	return client
+}
+
 func TestDanmuInfo(t *testing.T) {
-	client := &http.Client{}
-	info, err := GetDanmuInfo(client, 3)
+	server := startMockServer(t)
+	client := newClient(server)
+	info, err := GetDanmuInfo(context.Background(), client, 3)
 	if err != nil {
-		t.Logf("GetDanmuInfo Error, %v\n", err)
-		return
+		t.Fatalf("GetDanmuInfo Error, %v\n", err)
 	}
-	t.Logf("%+v", info)
+	AssertEqual(t, info.Data.Token, mock_server.MockToken)
+	AssertEqual(t, len(info.Data.HostList), 1)
+	AssertEqual(t, info.Data.HostList[0], server.DanmuHost())
 }
 
 func TestConnect(t *testing.T) {
-	client := &http.Client{}
-	info, err := GetDanmuInfo(client, 3)
+	server := startMockServer(t)
+	client := newClient(server)
+	info, err := GetDanmuInfo(context.Background(), client, 3)
 	if err != nil {
-		t.Logf("GetDanmuInfo Error, %v\n", err)
-		return
+		t.Fatalf("GetDanmuInfo Error, %v\n", err)
 	}
-	_, err = ConnectDanmuServer(0, 3, info)
+	room, err := ConnectDanmuServer(context.Background(), 0, "", 3, info, nil)
 	if err != nil {
-		t.Logf("Connect Error, %v\n", err)
-		return
+		t.Fatalf("Connect Error, %v\n", err)
+	}
+	room.Close()
+
+	info.Data.Token = "wrong token"
+	if _, err = ConnectDanmuServer(context.Background(), 0, "", 3, info, nil); err != danmuAuthErr {
+		t.Errorf("expected auth error, got %v", err)
 	}
 }
 
@@ -43,20 +105,105 @@ func TestConnectDanmuServer(t *testing.T) {
 	uid := uint64(0)
 	roomID := uint64(545068)
 
-	client := &http.Client{}
-	info, err := GetDanmuInfo(client, roomID)
+	server := startMockServer(t)
+	client := newClient(server)
+	info, err := GetDanmuInfo(context.Background(), client, roomID)
 	if err != nil {
-		t.Logf("GetDanmuInfo Error, %v\n", err)
-		return
+		t.Fatalf("GetDanmuInfo Error, %v\n", err)
 	}
 
-	server, err := ConnectDanmuServer(uid, roomID, info)
+	room, err := ConnectDanmuServer(context.Background(), uid, "", roomID, info, nil)
 	if err != nil {
-		t.Logf("ConnectDanmuServer Error, %v\n", err)
-		return
+		t.Fatalf("ConnectDanmuServer Error, %v\n", err)
+	}
+	defer room.Close()
+	waitConnected(t, server)
+
+	server.PushDanmu(1, "tester", "hello")
+	select {
+	case msg := <-room.MessageChan:
+		AssertEqual(t, msg.Cmd, "DANMU_MSG")
+		AssertEqual(t, msg.Info[1], "hello")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message received")
+	}
+}
+
+func TestConnectDanmuServerProxy(t *testing.T) {
+	server := startMockServer(t)
+	proxyServer, err := mock_server.StartProxy()
+	if err != nil {
+		t.Fatalf("start proxy failed, err=%v", err)
+	}
+	defer proxyServer.Close()
+	// 回环地址不走代理，这里用一个假域名，由代理换成模拟服务器的地址
+	host := server.DanmuHost()
+	proxyServer.Hosts[net.JoinHostPort("danmu.test", strconv.Itoa(host.Port))] = net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
+	host.Host = "danmu.test"
+
+	for _, scheme := range []string{"http", "socks5"} {
+		config := &api.BiliLiveConfig{DanmuTransport: api.DanmuTransportTCP, Proxy: scheme + "://" + proxyServer.Addr()}
+		dialer, err := proxyDialer(config)
+		if err != nil {
+			t.Fatalf("parse proxy failed, err=%v", err)
+		}
+		conn, addr, err := connectDanmuHosts(0, "", 7777, mock_server.MockToken, []api.DanmuHost{host}, config, dialer)
+		if err != nil {
+			t.Fatalf("connect through %s proxy failed, err=%v", scheme, err)
+		}
+		conn.Close()
+		AssertEqual(t, addr, "tcp://danmu.test")
+	}
+	AssertEqual(t, len(proxyServer.Targets()), 2)
+
+	// 绕过代理时直接解析假域名，应该连不上
+	config := &api.BiliLiveConfig{DanmuTransport: api.DanmuTransportTCP, Proxy: "socks5://" + proxyServer.Addr(), NoProxy: []string{"danmu.test"}}
+	dialer, _ := proxyDialer(config)
+	if _, _, err = connectDanmuHosts(0, "", 7777, mock_server.MockToken, []api.DanmuHost{host}, config, dialer); err == nil {
+		t.Errorf("bypassed host should not go through proxy")
+	}
+	AssertEqual(t, len(proxyServer.Targets()), 2)
+}
+
+func TestAuthAndConnect(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v\n", err)
+	}
+	defer room.Close()
+	AssertEqual(t, room.UID, uint64(0))
+	AssertEqual(t, room.OwnerId, uint64(mock_server.MockOwnerUID))
+	AssertEqual(t, room.Title, "模拟直播间")
+	if room.RoomUserInfo != nil {
+		t.Errorf("guest should not have room user info")
+	}
+}
+
+func TestHeartBeatRespMissing(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	// 服务端只读不回，模拟半开连接
+	go io.Copy(io.Discard, server)
+
+	room := &api.LiveRoom{
+		Seq:         1,
+		MessageChan: make(chan *api.DanmuMessage, 10),
+		ReqChan:     make(chan []byte, 10),
+		RetryChan:   make(chan struct{}),
+		StreamConn:  client,
+		Config:      &api.BiliLiveConfig{HeartBeatInterval: 1, HeartBeatMaxMissed: 1},
+	}
+	room.Start(context.Background())
+	defer room.Close()
+	defer client.Close()
+	room.Go(func() { processWrite(room) })
+	room.Go(func() { processRead(room) })
+
+	select {
+	case <-room.RetryChan:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("dead connection not detected")
 	}
-	time.Sleep(600 * time.Second)
-	close(server.DoneChan)
-	fmt.Println("Close DoneChan")
-	time.Sleep(10 * time.Second)
 }
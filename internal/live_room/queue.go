@@ -0,0 +1,190 @@
+package live_room
+
+import (
+	"sync"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+)
+
+const (
+	defaultQueueSize = 200
+	// queueSampleRate 抽样时低优先级消息每这么多条保留一条
+	queueSampleRate = 10
+	// dropLogInterval 每丢弃这么多条消息记一次日志
+	dropLogInterval = 100
+	// criticalQueueFactor 不能丢的消息最多占队列长度的这么多倍
+	criticalQueueFactor = 2
+)
+
+// criticalCmds 队列满时也不丢弃这些消息，超过criticalQueueFactor倍队列长度时才丢最早的一条
+var criticalCmds = map[string]bool{
+	api.CmdSuperChatMessage:       true,
+	api.CmdSuperChatMessageDelete: true,
+	api.CmdSendGift:               true,
+	api.CmdComboSend:              true,
+	api.CmdGuardBuy:               true,
+	api.CmdLive:                   true,
+	api.CmdPreparing:              true,
+	api.CmdWarning:                true,
+	api.CmdCutOff:                 true,
+}
+
+// lowPriorityCmds 队列压力大时优先抽样的消息
+var lowPriorityCmds = map[string]bool{
+	api.CmdInteractWord:     true,
+	api.CmdEntryEffect:      true,
+	api.CmdWatchedChange:    true,
+	api.CmdOnlineRankCount:  true,
+	api.CmdLikeInfoV3Update: true,
+}
+
+type queueItem struct {
+	cmd string
+	msg *api.DanmuMessage
+}
+
+// messageQueue 读循环只往这里放消息，由forward转发到MessageChan，
+// 界面卡住时丢弃消息而不是停止读取
+type messageQueue struct {
+	mu      sync.Mutex
+	items   []queueItem
+	size    int
+	policy  api.QueuePolicy
+	notify  chan struct{}
+	sampled uint64
+	dropped uint64
+	byCmd   map[string]uint64
+}
+
+func newMessageQueue(config *api.BiliLiveConfig) *messageQueue {
+	q := &messageQueue{
+		size:   defaultQueueSize,
+		policy: api.QueueDropOldest,
+		notify: make(chan struct{}, 1),
+		byCmd:  make(map[string]uint64),
+	}
+	if config != nil {
+		if config.QueueSize > 0 {
+			q.size = config.QueueSize
+		}
+		if config.QueuePolicy == api.QueueSample {
+			q.policy = api.QueueSample
+		}
+	}
+	return q
+}
+
+func (q *messageQueue) Push(msg *api.DanmuMessage) {
+	cmd := NormalizeCmd(msg.Cmd)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.policy == api.QueueSample && lowPriorityCmds[cmd] && len(q.items) >= q.size/2 {
+		q.sampled++
+		if q.sampled%queueSampleRate != 0 {
+			q.drop(cmd)
+			return
+		}
+	}
+	if len(q.items) >= q.size && !q.evict() {
+		// 队列里全是不能丢的消息
+		if !criticalCmds[cmd] {
+			q.drop(cmd)
+			return
+		}
+		if len(q.items) >= q.size*criticalQueueFactor {
+			q.drop(q.items[0].cmd)
+			q.items[0] = queueItem{}
+			q.items = q.items[1:]
+		}
+	}
+	q.items = append(q.items, queueItem{cmd: cmd, msg: msg})
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// evict 丢弃最早的一条可以丢弃的消息，抽样模式下先找低优先级的
+func (q *messageQueue) evict() bool {
+	index := -1
+	if q.policy == api.QueueSample {
+		for i, item := range q.items {
+			if lowPriorityCmds[item.cmd] {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		for i, item := range q.items {
+			if !criticalCmds[item.cmd] {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return false
+	}
+	q.drop(q.items[index].cmd)
+	q.items = append(q.items[:index], q.items[index+1:]...)
+	return true
+}
+
+func (q *messageQueue) drop(cmd string) {
+	q.dropped++
+	q.byCmd[cmd]++
+	if q.dropped == 1 || q.dropped%dropLogInterval == 0 {
+		logging.Warnf("message queue full, dropped=%d, by cmd=%v", q.dropped, q.byCmd)
+	}
+}
+
+func (q *messageQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+func (q *messageQueue) pop(done <-chan struct{}) (msg *api.DanmuMessage, ok bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			msg = q.items[0].msg
+			q.items[0] = queueItem{}
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			return msg, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-done:
+			return nil, false
+		case <-q.notify:
+		}
+	}
+}
+
+// forward 把队列里的消息按顺序转发到MessageChan，直到done关闭
+func (q *messageQueue) forward(out chan<- *api.DanmuMessage, done <-chan struct{}) {
+	for {
+		msg, ok := q.pop(done)
+		if !ok {
+			return
+		}
+		select {
+		case <-done:
+			return
+		case out <- msg:
+		}
+	}
+}
+
+// deliverMessage 没有队列时直接写入MessageChan
+func deliverMessage(room *api.LiveRoom, msg *api.DanmuMessage) {
+	if room.Queue != nil {
+		room.Queue.Push(msg)
+		return
+	}
+	room.MessageChan <- msg
+}
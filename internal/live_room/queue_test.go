@@ -0,0 +1,87 @@
+package live_room
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func queueCmds(q *messageQueue) string {
+	var cmds []string
+	for _, item := range q.items {
+		cmds = append(cmds, item.msg.Cmd)
+	}
+	return strings.Join(cmds, ",")
+}
+
+func TestMessageQueueDropOldest(t *testing.T) {
+	q := newMessageQueue(&api.BiliLiveConfig{QueueSize: 3})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSuperChatMessage})
+	q.Push(&api.DanmuMessage{Cmd: "DANMU_MSG:4:0:2:2:2:0"})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdInteractWord})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSendGift})
+	AssertEqual(t, queueCmds(q), strings.Join([]string{api.CmdSuperChatMessage, api.CmdInteractWord, api.CmdSendGift}, ","))
+	AssertEqual(t, q.Dropped(), uint64(1))
+	AssertEqual(t, q.byCmd[api.CmdDanmuMsg], uint64(1))
+
+	// SC和礼物占满队列时丢弃新来的普通消息，但不丢弃新的礼物
+	q.Push(&api.DanmuMessage{Cmd: api.CmdGuardBuy})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdDanmuMsg})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSendGift})
+	AssertEqual(t, queueCmds(q), strings.Join([]string{api.CmdSuperChatMessage, api.CmdSendGift, api.CmdGuardBuy, api.CmdSendGift}, ","))
+	AssertEqual(t, q.Dropped(), uint64(3))
+
+	// 不能丢的消息超过两倍队列长度时丢最早的一条
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSuperChatMessage})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdGuardBuy})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdComboSend})
+	AssertEqual(t, queueCmds(q), strings.Join([]string{api.CmdSendGift, api.CmdGuardBuy, api.CmdSendGift, api.CmdSuperChatMessage, api.CmdGuardBuy, api.CmdComboSend}, ","))
+	AssertEqual(t, q.Dropped(), uint64(4))
+	AssertEqual(t, q.byCmd[api.CmdSuperChatMessage], uint64(1))
+}
+
+func TestMessageQueueSample(t *testing.T) {
+	q := newMessageQueue(&api.BiliLiveConfig{QueueSize: 4, QueuePolicy: api.QueueSample})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdDanmuMsg})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdDanmuMsg})
+	// 队列过半后进场消息每queueSampleRate条只保留一条
+	for i := 0; i < queueSampleRate; i++ {
+		q.Push(&api.DanmuMessage{Cmd: api.CmdInteractWord})
+	}
+	AssertEqual(t, queueCmds(q), strings.Join([]string{api.CmdDanmuMsg, api.CmdDanmuMsg, api.CmdInteractWord}, ","))
+	AssertEqual(t, q.Dropped(), uint64(queueSampleRate-1))
+
+	// 队列满时先丢低优先级消息
+	q.Push(&api.DanmuMessage{Cmd: api.CmdDanmuMsg})
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSuperChatMessage})
+	AssertEqual(t, queueCmds(q), strings.Join([]string{api.CmdDanmuMsg, api.CmdDanmuMsg, api.CmdDanmuMsg, api.CmdSuperChatMessage}, ","))
+}
+
+func TestMessageQueueForward(t *testing.T) {
+	q := newMessageQueue(nil)
+	out := make(chan *api.DanmuMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go q.forward(out, done)
+	// 没有人读取时Push也不会阻塞
+	for i := 0; i < defaultQueueSize*2; i++ {
+		q.Push(&api.DanmuMessage{Cmd: api.CmdDanmuMsg})
+	}
+	q.Push(&api.DanmuMessage{Cmd: api.CmdSendGift})
+	// forward可能已经取出了一条正在等待写入
+	received := 0
+	for received <= defaultQueueSize+1 {
+		select {
+		case msg := <-out:
+			received++
+			if msg.Cmd == api.CmdSendGift {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("forward timeout")
+		}
+	}
+	t.Fatalf("queue not bounded, received=%d", received)
+}
@@ -0,0 +1,147 @@
+package live_room
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/proxy"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+)
+
+const (
+	defaultMaxReconnect = 10
+	reconnectBaseDelay  = time.Second
+	reconnectMaxDelay   = time.Minute
+)
+
+// reconnectDelay 指数退避，在[d/2, d)之间加上随机抖动，避免大量客户端同时重连
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < 16 {
+		delay = reconnectBaseDelay << (attempt - 1)
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+func maxReconnect(config *api.BiliLiveConfig) int {
+	if config != nil && config.MaxReconnect > 0 {
+		return config.MaxReconnect
+	}
+	return defaultMaxReconnect
+}
+
+// notifyStatus 不阻塞，界面来不及处理时丢弃
+func notifyStatus(room *api.LiveRoom, status *api.ConnStatus) {
+	if room.StatusChan == nil {
+		return
+	}
+	status.Time = time.Now()
+	select {
+	case room.StatusChan <- status:
+	default:
+		logging.Warnf("conn status dropped, status=%+v", status)
+	}
+}
+
+// monitorConn 负责当前连接的关闭和重连，重连放弃时关闭整个房间
+func monitorConn(room *api.LiveRoom, dialer *proxy.Dialer) {
+	defer func() {
+		room.StreamConn.Close()
+	}()
+	for {
+		select {
+		case <-room.DoneChan:
+			notifyStatus(room, &api.ConnStatus{State: api.ConnClosed, Host: room.DanmuHost, Err: room.Context().Err()})
+			logging.Infof("monitor goroutine quit")
+			return
+		case <-room.RetryChan:
+			logging.Infof("retry connect danmu server")
+			room.StreamConn.Close()
+			if !reconnect(room, dialer) {
+				room.Cancel()
+				logging.Infof("monitor goroutine quit")
+				return
+			}
+			room.Go(func() { processWrite(room) })
+			room.Go(func() { processRead(room) })
+		}
+	}
+}
+
+// reconnect 轮流尝试HostList中的每个服务器，认证失败时重新获取token，
+// 超过最大次数或房间关闭时返回false
+func reconnect(room *api.LiveRoom, dialer *proxy.Dialer) bool {
+	var (
+		info    *api.DanmuInfoResp
+		lastErr error
+	)
+	maxAttempt := maxReconnect(room.Config)
+	for attempt := 1; attempt <= maxAttempt; attempt++ {
+		delay := reconnectDelay(attempt)
+		notifyStatus(room, &api.ConnStatus{
+			State:      api.ConnReconnecting,
+			Attempt:    attempt,
+			MaxAttempt: maxAttempt,
+			Delay:      delay,
+			Err:        lastErr,
+		})
+		select {
+		case <-room.DoneChan:
+			return false
+		case <-time.After(delay):
+		}
+
+		if info == nil {
+			if info, lastErr = GetDanmuInfo(room.Context(), room.Client, room.RoomID); lastErr == nil && len(info.Data.HostList) == 0 {
+				lastErr = noServerErr
+			}
+			if lastErr != nil {
+				logging.Errorf("retry get danmu info failed, attempt=%d, err=%v", attempt, lastErr)
+				info = nil
+				continue
+			}
+		}
+		host := info.Data.HostList[(attempt-1)%len(info.Data.HostList)]
+		notifyStatus(room, &api.ConnStatus{
+			State:      api.ConnConnecting,
+			Attempt:    attempt,
+			MaxAttempt: maxAttempt,
+			Host:       host.Host,
+		})
+		conn, addr, err := connectDanmuHosts(room.UID, room.Buvid, room.RoomID, info.Data.Token, []api.DanmuHost{host}, room.Config, dialer)
+		if err != nil {
+			logging.Errorf("retry connect danmu server failed, attempt=%d, host=%s, err=%v", attempt, host.Host, err)
+			if errors.Is(err, danmuAuthErr) {
+				// token可能已经过期，下次重试前重新获取
+				info = nil
+			}
+			lastErr = err
+			continue
+		}
+		logging.Infof("retry connect danmu server success, attempt=%d, host=%s", attempt, host.Host)
+		room.StreamConn = conn
+		room.DanmuHost = addr
+		room.RetryChan = make(chan struct{})
+		notifyStatus(room, &api.ConnStatus{
+			State:      api.ConnConnected,
+			Attempt:    attempt,
+			MaxAttempt: maxAttempt,
+			Host:       addr,
+		})
+		return true
+	}
+	logging.Errorf("retry connect danmu server give up, max attempt=%d, err=%v", maxAttempt, lastErr)
+	notifyStatus(room, &api.ConnStatus{
+		State:      api.ConnClosed,
+		Attempt:    maxAttempt,
+		MaxAttempt: maxAttempt,
+		Err:        lastErr,
+	})
+	return false
+}
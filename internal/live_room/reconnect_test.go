@@ -0,0 +1,62 @@
+package live_room
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	for attempt := 1; attempt <= 64; attempt++ {
+		delay := reconnectDelay(attempt)
+		limit := reconnectMaxDelay
+		if attempt < 8 && reconnectBaseDelay<<(attempt-1) < limit {
+			limit = reconnectBaseDelay << (attempt - 1)
+		}
+		if delay < limit/2 || delay >= limit {
+			t.Errorf("attempt %d delay %v out of range [%v, %v)", attempt, delay, limit/2, limit)
+		}
+	}
+	if reconnectDelay(1) > time.Second {
+		t.Errorf("first retry should happen within one second")
+	}
+}
+
+func TestConnStatus(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777, MaxReconnect: 3})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	defer room.Close()
+	status := waitStatus(t, room, api.ConnConnected)
+	AssertEqual(t, status.Attempt, 0)
+	if status.Host == "" {
+		t.Errorf("connected status without host")
+	}
+	// 连上后马上发心跳，回复带上延迟
+	if status = waitStatus(t, room, api.ConnConnected); status.RTT <= 0 {
+		t.Errorf("expected heartbeat rtt, got %v", status.RTT)
+	}
+
+	server.CloseConns()
+	if status = waitStatus(t, room, api.ConnDisconnected); status.Err == nil {
+		t.Errorf("disconnected without error")
+	}
+	status = <-room.StatusChan
+	AssertEqual(t, status.State, api.ConnReconnecting)
+	AssertEqual(t, status.Attempt, 1)
+	status = <-room.StatusChan
+	AssertEqual(t, status.State, api.ConnConnecting)
+	status = <-room.StatusChan
+	AssertEqual(t, status.State, api.ConnConnected)
+	AssertEqual(t, status.Attempt, 1)
+
+	room.Close()
+	AssertEqual(t, waitStatus(t, room, api.ConnClosed).State, api.ConnClosed)
+}
@@ -0,0 +1,82 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var (
+	// DanmuShieldedErr 弹幕包含全站屏蔽词
+	DanmuShieldedErr = errors.New("danmu contains shielded word")
+	// DanmuRoomShieldedErr 弹幕包含房间设置的屏蔽词
+	DanmuRoomShieldedErr = errors.New("danmu contains room shielded word")
+)
+
+// SendDanmu 发送弹幕，被屏蔽词拦截时接口返回成功，这里转成错误
+func SendDanmu(ctx context.Context, client *api.Client, contentType string, form io.Reader) (err error) {
+	var resp api.SendMsgResp
+	if err = client.Post(ctx, client.BaseURLs.Live+"/msg/send", contentType, form, &resp); err != nil {
+		return
+	}
+	switch resp.Message {
+	case "f":
+		err = DanmuShieldedErr
+	case "k":
+		err = DanmuRoomShieldedErr
+	}
+	return
+}
+
+// DanmuSendInterval 服务器要求的两条弹幕之间的最短间隔，发太快会返回10030
+const DanmuSendInterval = time.Second
+
+// Sender 按DanmuSendInterval排队发送弹幕，多条弹幕同时发送时依次等待
+type Sender struct {
+	Client   *api.Client
+	Interval time.Duration
+
+	mu     sync.Mutex
+	lastAt time.Time
+}
+
+func NewSender(client *api.Client) *Sender {
+	return &Sender{Client: client, Interval: DanmuSendInterval}
+}
+
+func (s *Sender) Send(ctx context.Context, contentType string, form io.Reader) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wait := time.Until(s.lastAt.Add(s.Interval)); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	err = SendDanmu(ctx, s.Client, contentType, form)
+	s.lastAt = time.Now()
+	return
+}
+
+// SplitDanmu 按字符数把content切成每段不超过limit的弹幕，limit不大于0时不切分
+func SplitDanmu(content string, limit int) (parts []string) {
+	runes := []rune(content)
+	if limit <= 0 || len(runes) <= limit {
+		return []string{content}
+	}
+	for len(runes) > limit {
+		parts = append(parts, string(runes[:limit]))
+		runes = runes[limit:]
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return
+}
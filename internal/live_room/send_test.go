@@ -0,0 +1,138 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func sendForm(t *testing.T, client *api.Client, msg string) error {
+	t.Helper()
+	form := url.Values{"msg": {msg}, "csrf": {mock_server.MockCSRF}}
+	return SendDanmu(context.Background(), client, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
+
+func TestSendDanmu(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+
+	if err := sendForm(t, client, "hello"); !api.IsCode(err, api.CodeNotLogin) {
+		t.Errorf("send before login, err=%v", err)
+	}
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+	if err := sendForm(t, client, "hello"); err != nil {
+		t.Fatalf("send failed, err=%v", err)
+	}
+	if err := sendForm(t, client, "这里有"+mock_server.MockShieldWord); !errors.Is(err, DanmuShieldedErr) {
+		t.Errorf("shielded danmu, err=%v", err)
+	}
+	server.SetSendError(api.CodeDanmuMuted, "你已被禁言")
+	if err := sendForm(t, client, "hello"); !api.IsCode(err, api.CodeDanmuMuted) {
+		t.Errorf("send when muted, err=%v", err)
+	}
+	server.SetSendError(0, "")
+	if err := sendForm(t, client, "hello"); err != nil {
+		t.Errorf("send after unmute, err=%v", err)
+	}
+}
+
+func TestSplitDanmu(t *testing.T) {
+	for _, c := range []struct {
+		content string
+		limit   int
+		parts   []string
+	}{
+		{"hello", 20, []string{"hello"}},
+		{"hello", 0, []string{"hello"}},
+		{"一二三四五六七", 3, []string{"一二三", "四五六", "七"}},
+		{"一二三四五六", 3, []string{"一二三", "四五六"}},
+		{"ab😀cd", 3, []string{"ab😀", "cd"}},
+	} {
+		parts := SplitDanmu(c.content, c.limit)
+		if strings.Join(parts, "|") != strings.Join(c.parts, "|") {
+			t.Errorf("split %q by %d, got %q, want %q", c.content, c.limit, parts, c.parts)
+		}
+	}
+}
+
+func TestSenderInterval(t *testing.T) {
+	server := startMockServer(t)
+	server.SendInterval = 100 * time.Millisecond
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+
+	if err := sendForm(t, client, "1"); err != nil {
+		t.Fatalf("send failed, err=%v", err)
+	}
+	if err := sendForm(t, client, "2"); !api.IsCode(err, api.CodeDanmuTooFast) {
+		t.Errorf("send too fast, err=%v", err)
+	}
+
+	time.Sleep(server.SendInterval)
+	sender := NewSender(client)
+	sender.Interval = server.SendInterval
+	for _, msg := range SplitDanmu("一二三四五六七八九十", 4) {
+		form := url.Values{"msg": {msg}, "csrf": {mock_server.MockCSRF}}
+		if err := sender.Send(context.Background(), "application/x-www-form-urlencoded", strings.NewReader(form.Encode())); err != nil {
+			t.Fatalf("send %q failed, err=%v", msg, err)
+		}
+	}
+}
+
+func TestSendReply(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	defer client.HTTP.CloseIdleConnections()
+	parseCookieStr(client, "SESSDATA="+mock_server.MockSessData+"; bili_jct="+mock_server.MockCSRF)
+	info, err := GetDanmuInfo(context.Background(), client, server.RoomID)
+	if err != nil {
+		t.Fatalf("GetDanmuInfo Error, %v\n", err)
+	}
+	room, err := ConnectDanmuServer(context.Background(), 0, "", server.RoomID, info, nil)
+	if err != nil {
+		t.Fatalf("ConnectDanmuServer Error, %v\n", err)
+	}
+	defer room.Close()
+	waitConnected(t, server)
+	receive := func() *api.DanmuMsgEvent {
+		select {
+		case msg := <-room.MessageChan:
+			event, err := DecodeEvent(msg)
+			if err != nil {
+				t.Fatalf("decode event failed, err=%v", err)
+			}
+			return event.(*api.DanmuMsgEvent)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message received")
+		}
+		return nil
+	}
+
+	server.PushDanmu(20001, "观众", "晚上好")
+	target := receive()
+	if target.DmID == "" {
+		t.Fatalf("danmu id missing")
+	}
+	form := url.Values{
+		"msg":         {"晚上好"},
+		"csrf":        {mock_server.MockCSRF},
+		"reply_mid":   {strconv.FormatUint(target.UID, 10)},
+		"replay_dmid": {target.DmID},
+	}
+	if err = SendDanmu(context.Background(), client, "application/x-www-form-urlencoded", strings.NewReader(form.Encode())); err != nil {
+		t.Fatalf("send reply failed, err=%v", err)
+	}
+	reply := receive()
+	AssertEqual(t, reply.UID, uint64(mock_server.MockUID))
+	AssertEqual(t, reply.ReplyMid, uint64(20001))
+	AssertEqual(t, reply.ReplyUName, "观众")
+}
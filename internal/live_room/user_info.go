@@ -1,13 +1,13 @@
 package live_room
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"github.com/google/go-querystring/query"
 	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
 	"github.com/skip2/go-qrcode"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -19,20 +19,10 @@ var (
 	PollLoginError    = errors.New("poll login failed")
 )
 
-func QRCodeLogin(client *http.Client) (data *api.QRCodeLoginData, err error) {
-	baseURL := "https://passport.bilibili.com/x/passport-login/web/qrcode/generate"
-	resp, err := client.Get(baseURL)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
+func QRCodeLogin(ctx context.Context, client *api.Client) (data *api.QRCodeLoginData, err error) {
 	respData := new(api.QRCodeGenerateResp)
-	if err = json.Unmarshal(body, respData); err != nil || respData.Code != 0 {
-		err = QRCodeGenerateErr
+	if err = client.Get(ctx, client.BaseURLs.Passport+"/x/passport-login/web/qrcode/generate", nil, respData); err != nil {
+		err = fmt.Errorf("%w: %w", QRCodeGenerateErr, err)
 		return
 	}
 	q, err := qrcode.New(respData.Data.Url, qrcode.Low)
@@ -49,22 +39,23 @@ func QRCodeLogin(client *http.Client) (data *api.QRCodeLoginData, err error) {
 	return
 }
 
-func PollLogin(client *http.Client, data *api.QRCodeLoginData) (cookie string, err error) {
-	baseURL := "https://passport.bilibili.com/x/passport-login/web/qrcode/poll"
-	realURL := fmt.Sprintf("%s?qrcode_key=%s", baseURL, data.QRKey)
-	resp, err := client.Get(realURL)
+func PollLogin(ctx context.Context, client *api.Client, data *api.QRCodeLoginData) (cookie string, err error) {
+	params := struct {
+		QRCodeKey string `url:"qrcode_key"`
+	}{QRCodeKey: data.QRKey}
+	v, err := query.Values(params)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	realURL := fmt.Sprintf("%s?%s", client.BaseURLs.Passport+"/x/passport-login/web/qrcode/poll", v.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realURL, nil)
 	if err != nil {
 		return
 	}
 	var pollLogin api.PollLoginResp
-	err = json.Unmarshal(body, &pollLogin)
-	if err != nil || pollLogin.Code != 0 {
-		err = PollLoginError
+	resp, err := client.DoResponse(req, &pollLogin)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", PollLoginError, err)
 		return
 	}
 	data.Status = pollLogin.Data.Code
@@ -84,79 +75,94 @@ func PollLogin(client *http.Client, data *api.QRCodeLoginData) (cookie string, e
 	return
 }
 
-func parseCookieStr(client *http.Client, cookies string) {
+func parseCookieStr(client *api.Client, cookies string) {
 	defer func() {
 		recover()
 	}()
-	jar, _ := cookiejar.New(nil)
 	elements := strings.Split(cookies, ";")
 	var cookieSlice []*http.Cookie
 	for _, element := range elements {
 		element := strings.TrimSpace(element)
 		nameValue := strings.Split(element, "=")
 		cookie := &http.Cookie{
-			Name:   nameValue[0],
-			Value:  nameValue[1],
-			Path:   "/",
-			Domain: ".bilibili.com",
+			Name:  nameValue[0],
+			Value: nameValue[1],
 		}
 		cookieSlice = append(cookieSlice, cookie)
 	}
-	u, _ := url.Parse("https://bilibili.com")
-	jar.SetCookies(u, cookieSlice)
-	client.Jar = jar
+	setJarCookies(client, cookieSlice)
 }
 
-func CheckCookieValid(client *http.Client, cookie string) bool {
+func CheckCookieValid(ctx context.Context, client *api.Client, cookie string) bool {
 	if cookie == "" {
 		return false
 	}
 	parseCookieStr(client, cookie)
-	return CheckAuth(client)
+	return CheckAuth(ctx, client)
 }
 
-func CheckAuth(client *http.Client) bool {
-	baseURL := "https://account.bilibili.com/site/getCoin"
-	resp, err := client.Get(baseURL)
-	if err != nil {
-		return false
+func CheckAuth(ctx context.Context, client *api.Client) bool {
+	err := client.Get(ctx, client.BaseURLs.Account+"/site/getCoin", nil, nil)
+	if err != nil && !api.IsCode(err, api.CodeNotLogin) {
+		logging.Warnf("check auth failed, err=%v", err)
 	}
+	return err == nil
+}
 
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+// GetUserInfo 未登录时返回CodeNotLogin的APIError，同时会更新WBI签名的key
+func GetUserInfo(ctx context.Context, client *api.Client) (info *api.UserInfo, err error) {
+	userInfo := new(api.UserInfo)
+	err = client.Get(ctx, client.BaseURLs.Main+"/x/web-interface/nav", nil, userInfo)
+	updateWbiKeys(client, userInfo.Data.WbiImg)
 	if err != nil {
-		return false
-	}
-	var data map[string]interface{}
-	if err = json.Unmarshal(respBody, &data); err != nil {
-		return false
+		return
 	}
-	return data["code"].(float64) == 0
+	return userInfo, nil
 }
 
-func GetUserInfo(client *http.Client) *api.UserInfo {
-	baseURL := "https://api.bilibili.com/x/web-interface/nav"
-	resp, err := client.Get(baseURL)
-	if err != nil {
-		return nil
+func getCSRF(client *api.Client) string {
+	return jarCookie(client, "bili_jct")
+}
+
+// setJarCookies 把cookie加到client已有的jar里，登录的cookie和游客的buvid互不覆盖
+func setJarCookies(client *api.Client, cookies []*http.Cookie) {
+	jar := client.HTTP.Jar
+	if jar == nil {
+		jar, _ = cookiejar.New(nil)
 	}
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil
+	var domainCookies []*http.Cookie
+	for _, cookie := range cookies {
+		domainCookies = append(domainCookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/", Domain: ".bilibili.com"})
 	}
-	var userInfo api.UserInfo
-	if err = json.Unmarshal(respBody, &userInfo); err != nil || userInfo.Code != 0 {
-		return nil
+	u, _ := url.Parse("https://bilibili.com")
+	jar.SetCookies(u, domainCookies)
+	// 服务器地址不在bilibili.com下时（比如模拟服务器），cookie只能按host单独设置
+	b := client.BaseURLs
+	for _, baseURL := range []string{b.Live, b.Main, b.Passport, b.Account, b.LiveTrace} {
+		u, err := url.Parse(baseURL)
+		if err != nil || strings.HasSuffix(u.Hostname(), "bilibili.com") {
+			continue
+		}
+		var hostCookies []*http.Cookie
+		for _, cookie := range cookies {
+			hostCookies = append(hostCookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"})
+		}
+		jar.SetCookies(u, hostCookies)
 	}
-	return &userInfo
+	client.HTTP.Jar = jar
 }
 
-func getCSRF(client *http.Client) string {
-	u, _ := url.Parse("https://bilibili.com")
-	cookies := client.Jar.Cookies(u)
-	for _, cookie := range cookies {
-		if cookie.Name == "bili_jct" {
+// jarCookie 直播接口请求时会带上的cookie值，没有时返回空字符串
+func jarCookie(client *api.Client, name string) string {
+	if client.HTTP.Jar == nil {
+		return ""
+	}
+	u, err := url.Parse(client.BaseURLs.Live)
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range client.HTTP.Jar.Cookies(u) {
+		if cookie.Name == name {
 			return cookie.Value
 		}
 	}
@@ -0,0 +1,54 @@
+package live_room
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+)
+
+func TestQRCodeLogin(t *testing.T) {
+	server := startMockServer(t)
+	// QRCodeLogin会在当前目录写入login.png
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	client := newClient(server)
+	// 登录前接口返回未登录的错误码
+	if _, err := GetUserInfo(context.Background(), client); !api.IsCode(err, api.CodeNotLogin) {
+		t.Errorf("expected not login error, got %v", err)
+	}
+	loginData, err := QRCodeLogin(context.Background(), client)
+	if err != nil {
+		t.Fatalf("QRCodeLogin Error, %v", err)
+	}
+	var cookie string
+	for _, status := range []api.QRLoginStatus{api.QRLoginNotScan, api.QRLoginNotConfirm, api.QRLoginSuccess} {
+		if cookie, err = PollLogin(context.Background(), client, loginData); err != nil {
+			t.Fatalf("PollLogin Error, %v", err)
+		}
+		AssertEqual(t, loginData.Status, status)
+	}
+	if !CheckCookieValid(context.Background(), client, cookie) {
+		t.Fatalf("cookie from login should be valid, cookie=%s", cookie)
+	}
+	userInfo, err := GetUserInfo(context.Background(), client)
+	if err != nil {
+		t.Fatalf("GetUserInfo failed after login, err=%v", err)
+	}
+	AssertEqual(t, userInfo.Data.Mid, uint64(mock_server.MockUID))
+
+	room, err := AuthAndConnect(context.Background(), client, &api.BiliLiveConfig{RoomID: 7777})
+	if err != nil {
+		t.Fatalf("AuthAndConnect Error, %v", err)
+	}
+	defer room.Close()
+	AssertEqual(t, room.UID, uint64(mock_server.MockUID))
+	AssertEqual(t, room.CSRF, mock_server.MockCSRF)
+	if room.RoomUserInfo == nil {
+		t.Errorf("login user should have room user info")
+	}
+}
@@ -0,0 +1,92 @@
+package live_room
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/wbi"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
+)
+
+// wbiKeyTTL 网页端的key每天更换，缓存一段时间后重新获取
+const wbiKeyTTL = time.Hour
+
+var wbiKeyErr = errors.New("wbi key not found in nav response")
+
+// wbiSigner 缓存nav接口返回的key，给client.GetSigned的参数签名
+type wbiSigner struct {
+	client *api.Client
+
+	mu        sync.Mutex
+	mixinKey  string
+	updatedAt time.Time
+}
+
+// UseWbi 给client装上WBI签名，之后GetSigned发出的请求都会带上签名
+func UseWbi(client *api.Client) {
+	client.Signer = &wbiSigner{client: client}
+}
+
+// updateWbiKeys 每次请求nav接口都顺便更新缓存
+func updateWbiKeys(client *api.Client, img api.WbiImg) {
+	s, ok := client.Signer.(*wbiSigner)
+	if !ok {
+		return
+	}
+	mixinKey := wbi.MixinKey(wbi.KeyFromURL(img.ImgURL), wbi.KeyFromURL(img.SubURL))
+	if mixinKey == "" {
+		return
+	}
+	s.mu.Lock()
+	s.mixinKey = mixinKey
+	s.updatedAt = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *wbiSigner) Reset() {
+	logging.Warnf("wbi signature rejected, refresh key")
+	s.mu.Lock()
+	s.mixinKey = ""
+	s.mu.Unlock()
+}
+
+func (s *wbiSigner) cachedMixinKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.updatedAt) > wbiKeyTTL {
+		return ""
+	}
+	return s.mixinKey
+}
+
+func (s *wbiSigner) getMixinKey(ctx context.Context) (mixinKey string, err error) {
+	if mixinKey = s.cachedMixinKey(); mixinKey != "" {
+		return
+	}
+	// 未登录时code为-101，但wbi_img照样有
+	var userInfo api.UserInfo
+	err = s.client.Get(ctx, s.client.BaseURLs.Main+"/x/web-interface/nav", nil, &userInfo)
+	if err != nil && !api.IsCode(err, api.CodeNotLogin) {
+		return
+	}
+	err = nil
+	updateWbiKeys(s.client, userInfo.Data.WbiImg)
+	if mixinKey = s.cachedMixinKey(); mixinKey == "" {
+		err = wbiKeyErr
+	}
+	return
+}
+
+// Sign 拿不到key时退回不签名的请求
+func (s *wbiSigner) Sign(ctx context.Context, params url.Values) (string, error) {
+	mixinKey, err := s.getMixinKey(ctx)
+	if err != nil {
+		logging.Warnf("get wbi key failed, send without signature, err=%v", err)
+		return params.Encode(), nil
+	}
+	return wbi.Sign(params, mixinKey, time.Now().Unix()), nil
+}
@@ -0,0 +1,51 @@
+package live_room
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/mock_server"
+	"github.com/shr-go/bili_live_tui/internal/wbi"
+)
+
+func TestWbiKeyCache(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+
+	// 没有缓存时先从nav接口获取key
+	if _, err := GetDanmuInfo(context.Background(), client, 7777); err != nil {
+		t.Fatalf("GetDanmuInfo Error, %v", err)
+	}
+	AssertEqual(t, client.Signer.(*wbiSigner).cachedMixinKey(), wbi.MixinKey(mock_server.MockImgKey, mock_server.MockSubKey))
+
+	// 服务器换了key，旧签名返回-352后刷新key重试
+	server.SetWbiKeys(mock_server.MockSubKey, mock_server.MockImgKey)
+	if _, err := GetDanmuInfo(context.Background(), client, 7777); err != nil {
+		t.Fatalf("GetDanmuInfo after key rotation Error, %v", err)
+	}
+	AssertEqual(t, client.Signer.(*wbiSigner).cachedMixinKey(), wbi.MixinKey(mock_server.MockSubKey, mock_server.MockImgKey))
+
+	// GetUserInfo请求nav时也会更新缓存
+	client.Signer.Reset()
+	GetUserInfo(context.Background(), client)
+	AssertEqual(t, client.Signer.(*wbiSigner).cachedMixinKey(), wbi.MixinKey(mock_server.MockSubKey, mock_server.MockImgKey))
+}
+
+func TestWbiUnsigned(t *testing.T) {
+	server := startMockServer(t)
+	client := newClient(server)
+	// 直接请求不带签名会被风控
+	baseURL := client.BaseURLs.Live + "/xlive/web-room/v1/index/getDanmuInfo"
+	var info api.DanmuInfoResp
+	err := client.Get(context.Background(), baseURL, api.DanmuInfoReq{ID: 7777}, &info)
+	if !api.IsCode(err, api.CodeRiskControl) {
+		t.Fatalf("expected risk control error, got %v", err)
+	}
+	AssertEqual(t, info.Code, api.CodeRiskControl)
+
+	if err = client.GetSigned(context.Background(), baseURL, api.DanmuInfoReq{ID: 7777}, &info); err != nil {
+		t.Fatalf("GetSigned Error, %v", err)
+	}
+	AssertEqual(t, info.Code, 0)
+}
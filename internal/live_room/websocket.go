@@ -0,0 +1,246 @@
+package live_room
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/internal/proxy"
+)
+
+// 弹幕服务器的websocket只用到二进制帧，这里实现一个够用的最小客户端，
+// 包装成net.Conn后读写逻辑可以和tcp共用
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	wsHandshakeErr = errors.New("websocket handshake failed")
+	wsFrameErr     = errors.New("websocket frame invalid")
+)
+
+type wsConn struct {
+	net.Conn
+	br       *bufio.Reader
+	remain   uint64
+	mask     [4]byte
+	masked   bool
+	maskPos  int
+	writeMux sync.Mutex
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func dialWebsocket(rawURL string, timeout time.Duration, dialer *proxy.Dialer) (conn net.Conn, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	rawConn, err := dialer.Dial("tcp", u.Host, timeout)
+	if err != nil {
+		return
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(rawConn, &tls.Config{ServerName: u.Hostname()})
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err = tlsConn.Handshake(); err != nil {
+			rawConn.Close()
+			return
+		}
+		rawConn = tlsConn
+	}
+	if conn, err = wsHandshake(rawConn, u, timeout); err != nil {
+		rawConn.Close()
+	}
+	return
+}
+
+func wsHandshake(rawConn net.Conn, u *url.URL, timeout time.Duration) (conn net.Conn, err error) {
+	rawConn.SetDeadline(time.Now().Add(timeout))
+	defer rawConn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, 16)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+			"Origin":                {"https://live.bilibili.com"},
+		},
+		Host: u.Host,
+	}
+	if err = req.Write(rawConn); err != nil {
+		return
+	}
+	br := bufio.NewReader(rawConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		err = fmt.Errorf("%w, status=%s", wsHandshakeErr, resp.Status)
+		return
+	}
+	conn = &wsConn{Conn: rawConn, br: br}
+	return
+}
+
+// readFrameHeader 读取下一个帧头，控制帧在这里直接处理掉
+func (c *wsConn) readFrameHeader() (err error) {
+	for {
+		var head [2]byte
+		if _, err = io.ReadFull(c.br, head[:]); err != nil {
+			return
+		}
+		opCode := head[0] & 0x0F
+		c.masked = head[1]&0x80 != 0
+		length := uint64(head[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if c.masked {
+			if _, err = io.ReadFull(c.br, c.mask[:]); err != nil {
+				return
+			}
+		}
+		c.maskPos = 0
+
+		switch opCode {
+		case wsOpBinary, wsOpText, wsOpContinuation:
+			c.remain = length
+			return
+		case wsOpClose, wsOpPing, wsOpPong:
+			if length > 125 {
+				return wsFrameErr
+			}
+			payload := make([]byte, length)
+			if _, err = io.ReadFull(c.br, payload); err != nil {
+				return
+			}
+			c.unmask(payload)
+			switch opCode {
+			case wsOpClose:
+				c.writeFrame(wsOpClose, payload)
+				return io.EOF
+			case wsOpPing:
+				if err = c.writeFrame(wsOpPong, payload); err != nil {
+					return
+				}
+			}
+		default:
+			return wsFrameErr
+		}
+	}
+}
+
+func (c *wsConn) unmask(p []byte) {
+	if !c.masked {
+		return
+	}
+	for i := range p {
+		p[i] ^= c.mask[c.maskPos&3]
+		c.maskPos++
+	}
+}
+
+func (c *wsConn) Read(p []byte) (n int, err error) {
+	for c.remain == 0 {
+		if err = c.readFrameHeader(); err != nil {
+			return
+		}
+	}
+	if uint64(len(p)) > c.remain {
+		p = p[:c.remain]
+	}
+	n, err = c.br.Read(p)
+	c.unmask(p[:n])
+	c.remain -= uint64(n)
+	return
+}
+
+func (c *wsConn) Write(p []byte) (n int, err error) {
+	if err = c.writeFrame(wsOpBinary, p); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// writeFrame 客户端发出的帧必须带掩码
+func (c *wsConn) writeFrame(opCode byte, payload []byte) (err error) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opCode)
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	var mask [4]byte
+	if _, err = rand.Read(mask[:]); err != nil {
+		return
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i&3])
+	}
+	_, err = c.Conn.Write(frame)
+	return
+}
+
+func (c *wsConn) Close() error {
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(wsOpClose, nil)
+	return c.Conn.Close()
+}
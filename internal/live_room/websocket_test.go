@@ -0,0 +1,167 @@
+package live_room
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/codec"
+)
+
+// wsStandIn 一个只会回复认证包的websocket服务端，用来代替真实的弹幕服务器
+func wsStandIn(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sub" || r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed, err=%v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+
+		for {
+			opCode, payload, err := readClientFrame(rw.Reader)
+			if err != nil || opCode == wsOpClose {
+				return
+			}
+			header, err := codec.DecodeHeader(payload)
+			if err != nil {
+				t.Errorf("stand-in parse header failed, err=%v", err)
+				return
+			}
+			switch header.OpCode {
+			case api.DanmuOpAuth:
+				resp := codec.Pack([]byte(`{"code":0}`), api.DanmuProtolHeartBeat, api.DanmuOpAuthResp, 1)
+				writeServerFrame(rw.Writer, resp)
+			case api.DanmuOpHeartBeat:
+				resp := codec.Pack([]byte{0, 0, 0, 42}, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeatResp, 1)
+				writeServerFrame(rw.Writer, resp)
+			}
+			rw.Flush()
+		}
+	}))
+}
+
+func readClientFrame(r *bufio.Reader) (opCode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return
+	}
+	opCode = head[0] & 0x0F
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+func writeServerFrame(w io.Writer, payload []byte) {
+	frame := []byte{0x80 | wsOpBinary}
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else {
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	w.Write(append(frame, payload...))
+}
+
+func standInDanmuInfo(t *testing.T, server *httptest.Server) *api.DanmuInfoResp {
+	u, _ := url.Parse(server.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+	// 找一个确定没有监听的端口当作tcp端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	info := new(api.DanmuInfoResp)
+	info.Data.Token = "token"
+	info.Data.HostList = []api.DanmuHost{{Host: host, Port: closedPort, WssPort: port, WsPort: port}}
+	return info
+}
+
+func TestConnectDanmuServerWebsocket(t *testing.T) {
+	server := wsStandIn(t)
+	defer server.Close()
+	info := standInDanmuInfo(t, server)
+
+	conn, _, err := connectDanmuServer(0, "", 3, info, &api.BiliLiveConfig{DanmuTransport: api.DanmuTransportWS}, nil)
+	if err != nil {
+		t.Fatalf("connect over websocket failed, err=%v", err)
+	}
+	defer conn.Close()
+
+	conn.Write(codec.Pack([]byte("[object Object]"), api.DanmuProtolHeartBeat, api.DanmuOpHeartBeat, 2))
+	buf := make([]byte, 64)
+	n, err := io.ReadAtLeast(conn, buf, 20)
+	if err != nil {
+		t.Fatalf("read heart beat resp failed, err=%v", err)
+	}
+	header, err := codec.DecodeHeader(buf[:n])
+	if err != nil {
+		t.Fatalf("parse heart beat resp failed, err=%v", err)
+	}
+	AssertEqual(t, header.OpCode, api.DanmuOpHeartBeatResp)
+	AssertEqual(t, binary.BigEndian.Uint32(buf[16:20]), uint32(42))
+}
+
+func TestConnectDanmuServerFallback(t *testing.T) {
+	server := wsStandIn(t)
+	defer server.Close()
+	info := standInDanmuInfo(t, server)
+
+	// tcp端口没有监听，wss握手会失败，最后应该回落到ws
+	conn, _, err := connectDanmuServer(0, "", 3, info, &api.BiliLiveConfig{DanmuTransport: api.DanmuTransportAuto}, nil)
+	if err != nil {
+		t.Fatalf("auto transport fallback failed, err=%v", err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*wsConn); !ok {
+		t.Errorf("expected websocket conn, got %T", conn)
+	}
+
+	_, _, err = connectDanmuServer(0, "", 3, info, &api.BiliLiveConfig{DanmuTransport: api.DanmuTransportTCP}, nil)
+	if err == nil {
+		t.Errorf("tcp only transport should fail")
+	}
+}
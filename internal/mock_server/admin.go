@@ -0,0 +1,183 @@
+package mock_server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+// mockSilentPageSize 禁言列表每页的人数，和真实接口一样
+const mockSilentPageSize = 10
+
+// checkAdmin 房管接口都要求登录、csrf正确并且是房管
+func (s *Server) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return false
+	}
+	r.ParseForm()
+	if r.Method == http.MethodPost && r.FormValue("csrf") != MockCSRF {
+		writeJSON(w, -111, "csrf 校验失败", nil)
+		return false
+	}
+	s.mu.Lock()
+	admin := s.RoomAdmin
+	s.mu.Unlock()
+	if !admin {
+		writeJSON(w, -403, "非房管，没有权限", nil)
+		return false
+	}
+	return true
+}
+
+// MutedUsers 当前被禁言的用户
+func (s *Server) MutedUsers() []api.SilentUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]api.SilentUser(nil), s.silent...)
+}
+
+func (s *Server) handleAddSilentUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	tuid, _ := strconv.ParseUint(r.FormValue("tuid"), 10, 64)
+	hour, err := strconv.Atoi(r.FormValue("hour"))
+	if tuid == 0 || err != nil || hour < api.MuteHourForever {
+		writeJSON(w, -400, "参数错误", nil)
+		return
+	}
+	now := time.Now()
+	end := "本场直播"
+	switch {
+	case hour == api.MuteHourForever:
+		end = "永久"
+	case hour > 0:
+		end = now.Add(time.Duration(hour) * time.Hour).Format(time.DateTime)
+	}
+	s.mu.Lock()
+	tname := s.users[tuid]
+	for i := 0; i < len(s.silent); i++ {
+		if s.silent[i].TUID == tuid {
+			s.silent = append(s.silent[:i], s.silent[i+1:]...)
+			i--
+		}
+	}
+	s.silent = append(s.silent, api.SilentUser{
+		TUID:         tuid,
+		TName:        tname,
+		UID:          MockUID,
+		Name:         MockUName,
+		Ctime:        now.Format(time.DateTime),
+		BlockEndTime: end,
+	})
+	s.mu.Unlock()
+	s.Push(CmdMsg(api.CmdRoomBlockMsg, map[string]interface{}{"uid": tuid, "uname": tname, "operator": 2}))
+	writeJSON(w, 0, "0", map[string]interface{}{})
+}
+
+func (s *Server) handleDelSilentUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	tuid, _ := strconv.ParseUint(r.FormValue("tuid"), 10, 64)
+	s.mu.Lock()
+	found := false
+	for i, user := range s.silent {
+		if user.TUID == tuid {
+			s.silent = append(s.silent[:i], s.silent[i+1:]...)
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		writeJSON(w, -400, "该用户没有被禁言", nil)
+		return
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{})
+}
+
+func (s *Server) handleSilentUserList(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	silent := s.MutedUsers()
+	page, _ := strconv.Atoi(r.FormValue("ps"))
+	page = max(page, 1)
+	start := min((page-1)*mockSilentPageSize, len(silent))
+	end := min(start+mockSilentPageSize, len(silent))
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"data":       silent[start:end],
+		"total":      len(silent),
+		"total_page": (len(silent) + mockSilentPageSize - 1) / mockSilentPageSize,
+	})
+}
+
+// ShieldKeywords 房间设置的屏蔽词
+func (s *Server) ShieldKeywords() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.keywords...)
+}
+
+func (s *Server) hasShieldKeyword(msg string) bool {
+	for _, keyword := range s.ShieldKeywords() {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleAddShieldKeyword(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	keyword := strings.TrimSpace(r.FormValue("keyword"))
+	if keyword == "" {
+		writeJSON(w, -400, "屏蔽词不能为空", nil)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keywords {
+		if k == keyword {
+			writeJSON(w, -400, "屏蔽词已存在", nil)
+			return
+		}
+	}
+	s.keywords = append(s.keywords, keyword)
+	writeJSON(w, 0, "0", map[string]interface{}{})
+}
+
+func (s *Server) handleDelShieldKeyword(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	keyword := r.FormValue("keyword")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.keywords {
+		if k == keyword {
+			s.keywords = append(s.keywords[:i], s.keywords[i+1:]...)
+			writeJSON(w, 0, "0", map[string]interface{}{})
+			return
+		}
+	}
+	writeJSON(w, -400, "屏蔽词不存在", nil)
+}
+
+func (s *Server) handleShieldKeywordList(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAdmin(w, r) {
+		return
+	}
+	var list []api.ShieldKeyword
+	for _, keyword := range s.ShieldKeywords() {
+		list = append(list, api.ShieldKeyword{Keyword: keyword, UID: MockUID, Name: MockUName})
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{"keyword_list": list, "max_limit": 1000})
+}
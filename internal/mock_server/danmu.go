@@ -0,0 +1,78 @@
+package mock_server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/codec"
+)
+
+type danmuConn struct {
+	net.Conn
+	protoVer api.DanmuProtol
+	writeMux sync.Mutex
+}
+
+func (c *danmuConn) write(data []byte) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.Write(data)
+	return err
+}
+
+// push 根据认证时协商的协议版本发送一条普通消息
+func (c *danmuConn) push(body []byte) error {
+	return c.write(codec.PackBatch([][]byte{body}, c.protoVer))
+}
+
+func (s *Server) serveDanmu(rawConn net.Conn) {
+	conn := &danmuConn{Conn: rawConn}
+	defer conn.Close()
+
+	reader := codec.NewReader(rawConn)
+	rawConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header, body, err := reader.Next()
+	if err != nil || header.OpCode != api.DanmuOpAuth {
+		return
+	}
+	var authReq api.DanmuAuthPacketReq
+	if err = json.Unmarshal(body, &authReq); err != nil || authReq.Key != MockToken {
+		conn.write(codec.Pack([]byte(`{"code":-101}`), api.DanmuProtolHeartBeat, api.DanmuOpAuthResp, header.Sequence))
+		return
+	}
+	s.mu.Lock()
+	s.authBuvids = append(s.authBuvids, authReq.Buvid)
+	s.mu.Unlock()
+	conn.protoVer = api.DanmuProtol(authReq.ProtoVer)
+	if !codec.Supported(conn.protoVer) {
+		conn.protoVer = api.DanmuProtolNormal
+	}
+	if err = conn.write(codec.Pack([]byte(`{"code":0}`), api.DanmuProtolHeartBeat, api.DanmuOpAuthResp, header.Sequence)); err != nil {
+		return
+	}
+	rawConn.SetReadDeadline(time.Time{})
+	s.addConn(conn)
+	defer s.removeConn(conn)
+
+	for {
+		header, _, err := reader.Next()
+		if err != nil {
+			return
+		}
+		if header.OpCode == api.DanmuOpHeartBeat {
+			s.mu.Lock()
+			popularity := s.popularity
+			s.mu.Unlock()
+			resp := make([]byte, 4)
+			binary.BigEndian.PutUint32(resp, popularity)
+			if err = conn.write(codec.Pack(resp, api.DanmuProtolHeartBeat, api.DanmuOpHeartBeatResp, header.Sequence)); err != nil {
+				return
+			}
+		}
+	}
+}
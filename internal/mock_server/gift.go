@@ -0,0 +1,134 @@
+package mock_server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+const (
+	// MockGold 模拟账号初始的金瓜子，100金瓜子为1电池
+	MockGold = 10000
+	// CodeGiftNotEnough 余额或者包裹里的礼物不够
+	CodeGiftNotEnough = 200013
+)
+
+var mockGifts = []api.GiftConfig{
+	{ID: 31036, Name: "小花花", Price: 100, CoinType: api.CoinTypeGold},
+	{ID: 31039, Name: "牛哇牛哇", Price: 100, CoinType: api.CoinTypeGold},
+	{ID: 31164, Name: "粉丝团灯牌", Price: 100, CoinType: api.CoinTypeGold},
+	{ID: 1, Name: "辣条", Price: 100, CoinType: api.CoinTypeSilver},
+}
+
+func mockGift(id int64) (gift api.GiftConfig, ok bool) {
+	for _, gift = range mockGifts {
+		if gift.ID == id {
+			return gift, true
+		}
+	}
+	return
+}
+
+func newMockBag() []api.BagGift {
+	return []api.BagGift{
+		{BagID: 1001, GiftID: 31036, GiftName: "小花花", GiftNum: 5, ExpireAt: time.Now().Add(7 * 24 * time.Hour).Unix()},
+		{BagID: 1002, GiftID: 1, GiftName: "辣条", GiftNum: 20},
+	}
+}
+
+// Wallet 模拟账号当前的余额
+func (s *Server) Wallet() api.Wallet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wallet
+}
+
+func (s *Server) handleGiftConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 0, "0", map[string]interface{}{"list": mockGifts})
+}
+
+func (s *Server) handleBagList(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	s.mu.Lock()
+	bag := append([]api.BagGift(nil), s.bag...)
+	s.mu.Unlock()
+	writeJSON(w, 0, "0", map[string]interface{}{"list": bag})
+}
+
+func (s *Server) handleWallet(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	wallet := s.Wallet()
+	wallet.Bp = float64(wallet.Gold) / 100
+	writeJSON(w, 0, "0", wallet)
+}
+
+// handleSendGift 扣掉余额或包裹里的礼物，再把SEND_GIFT推给弹幕连接
+func (s *Server) handleSendGift(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	r.ParseForm()
+	if r.FormValue("csrf") != MockCSRF {
+		writeJSON(w, -111, "csrf 校验失败", nil)
+		return
+	}
+	giftID, _ := strconv.ParseInt(r.FormValue("gift_id"), 10, 64)
+	num, _ := strconv.Atoi(r.FormValue("gift_num"))
+	gift, ok := mockGift(giftID)
+	if !ok || num <= 0 {
+		writeJSON(w, -400, "参数错误", nil)
+		return
+	}
+	s.mu.Lock()
+	var errMessage string
+	switch r.URL.Path {
+	case "/xlive/revenue/v1/gift/sendBag":
+		bagID, _ := strconv.ParseInt(r.FormValue("bag_id"), 10, 64)
+		errMessage = "包裹里的礼物不足"
+		for i := range s.bag {
+			if s.bag[i].BagID == bagID && s.bag[i].GiftID == giftID && s.bag[i].GiftNum >= num {
+				s.bag[i].GiftNum -= num
+				errMessage = ""
+			}
+		}
+	case "/xlive/revenue/v1/gift/sendSilver":
+		if s.wallet.Silver < gift.Price*int64(num) {
+			errMessage = "银瓜子不足"
+		} else {
+			s.wallet.Silver -= gift.Price * int64(num)
+		}
+	default:
+		if s.wallet.Gold < gift.Price*int64(num) {
+			errMessage = "余额不足"
+		} else {
+			s.wallet.Gold -= gift.Price * int64(num)
+		}
+	}
+	s.mu.Unlock()
+	if errMessage != "" {
+		writeJSON(w, CodeGiftNotEnough, errMessage, nil)
+		return
+	}
+	s.Push(CmdMsg(api.CmdSendGift, map[string]interface{}{
+		"uid":        MockUID,
+		"uname":      MockUName,
+		"action":     "投喂",
+		"giftId":     gift.ID,
+		"giftName":   gift.Name,
+		"num":        num,
+		"price":      gift.Price,
+		"coin_type":  gift.CoinType,
+		"total_coin": gift.Price * int64(num),
+		"timestamp":  time.Now().Unix(),
+	}))
+	writeJSON(w, 0, "0", map[string]interface{}{})
+}
@@ -0,0 +1,301 @@
+package mock_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/wbi"
+)
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/room/v1/Room/get_info", s.handleRoomInfo)
+	mux.HandleFunc("/xlive/web-room/v1/index/getDanmuInfo", s.handleDanmuInfo)
+	mux.HandleFunc("/xlive/web-room/v1/index/getInfoByUser", s.handleInfoByUser)
+	mux.HandleFunc("/xlive/web-room/v1/index/getInfoByRoom", s.handleInfoByRoom)
+	mux.HandleFunc("/xlive/rdata-interface/v1/heartbeat/webHeartBeat", s.handleWebHeartBeat)
+	mux.HandleFunc("/msg/send", s.handleSendMsg)
+	mux.HandleFunc("/xlive/web-ucenter/v2/emoticon/GetEmoticons", s.handleEmoticons)
+	mux.HandleFunc("/xlive/web-room/v1/giftPanel/giftConfig", s.handleGiftConfig)
+	mux.HandleFunc("/xlive/web-room/v1/gift/bag_list", s.handleBagList)
+	mux.HandleFunc("/xlive/revenue/v1/wallet/myWallet", s.handleWallet)
+	mux.HandleFunc("/xlive/revenue/v1/gift/sendGold", s.handleSendGift)
+	mux.HandleFunc("/xlive/revenue/v1/gift/sendSilver", s.handleSendGift)
+	mux.HandleFunc("/xlive/revenue/v1/gift/sendBag", s.handleSendGift)
+	mux.HandleFunc("/xlive/app-ucenter/v1/like_info_v3/like/likeReportV3", s.handleLikeReport)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/AddSilentUser", s.handleAddSilentUser)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/DelSilentUser", s.handleDelSilentUser)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/GetSilentUserList", s.handleSilentUserList)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/AddShieldKeyword", s.handleAddShieldKeyword)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/DelShieldKeyword", s.handleDelShieldKeyword)
+	mux.HandleFunc("/xlive/web-ucenter/v1/banned/GetShieldKeywordList", s.handleShieldKeywordList)
+	mux.HandleFunc("/x/passport-login/web/qrcode/generate", s.handleQRCodeGenerate)
+	mux.HandleFunc("/x/passport-login/web/qrcode/poll", s.handleQRCodePoll)
+	mux.HandleFunc("/x/web-interface/nav", s.handleNav)
+	mux.HandleFunc("/site/getCoin", s.handleGetCoin)
+	mux.HandleFunc("/x/frontend/finger/spi", s.handleSpi)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"msg":     message,
+		"ttl":     1,
+		"data":    data,
+	})
+}
+
+func isLogin(r *http.Request) bool {
+	cookie, err := r.Cookie("SESSDATA")
+	return err == nil && cookie.Value == MockSessData
+}
+
+func (s *Server) handleRoomInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 0, "ok", map[string]interface{}{
+		"uid":         MockOwnerUID,
+		"room_id":     s.RoomID,
+		"short_id":    s.ShortID,
+		"title":       s.Title,
+		"live_status": 1,
+	})
+}
+
+// checkWbi 和真实接口一样，签名不对时返回-352
+func (s *Server) checkWbi(w http.ResponseWriter, r *http.Request) bool {
+	if wbi.Verify(r.URL.Query(), wbi.MixinKey(s.wbiKeys())) {
+		return true
+	}
+	writeJSON(w, -352, "-352", nil)
+	return false
+}
+
+func (s *Server) handleDanmuInfo(w http.ResponseWriter, r *http.Request) {
+	if !s.checkWbi(w, r) {
+		return
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"group":     "live",
+		"max_delay": 5000,
+		"token":     MockToken,
+		"host_list": []api.DanmuHost{s.DanmuHost()},
+	})
+}
+
+func (s *Server) handleInfoByUser(w http.ResponseWriter, r *http.Request) {
+	if !s.checkWbi(w, r) {
+		return
+	}
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	var property api.UserRoomProperty
+	property.UnameColor = ""
+	property.Danmu.Mode = 1
+	property.Danmu.Color = 16777215
+	property.Danmu.Length = s.DanmuLength
+	property.Danmu.RoomId = int(s.RoomID)
+	s.mu.Lock()
+	admin := s.RoomAdmin
+	s.mu.Unlock()
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"property": property,
+		"badge":    map[string]interface{}{"is_room_admin": admin},
+	})
+}
+
+func (s *Server) handleWebHeartBeat(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 0, "0", map[string]interface{}{"next_interval": 20})
+}
+
+func (s *Server) handleSendMsg(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		r.ParseForm()
+	}
+	if r.FormValue("csrf") != MockCSRF {
+		writeJSON(w, -111, "csrf 校验失败", nil)
+		return
+	}
+	msg := r.FormValue("msg")
+	if r.FormValue("dm_type") == strconv.Itoa(api.DmTypeEmoticon) {
+		emoticon, ok := mockEmoticons[msg]
+		if !ok || emoticon.Perm == 0 {
+			writeJSON(w, -400, "表情不可用", nil)
+			return
+		}
+		msg = emoticon.Emoji
+	} else if length := utf8.RuneCountInString(msg); length == 0 || length > s.DanmuLength {
+		writeJSON(w, -400, fmt.Sprintf("msg in 1-%d", s.DanmuLength), nil)
+		return
+	}
+	s.mu.Lock()
+	sendErr := s.sendErr
+	tooFast := s.SendInterval > 0 && time.Since(s.lastSendAt) < s.SendInterval
+	if !tooFast {
+		s.lastSendAt = time.Now()
+	}
+	s.mu.Unlock()
+	if tooFast {
+		writeJSON(w, 10030, "您发送弹幕的频率过快", nil)
+		return
+	}
+	if sendErr != nil {
+		writeJSON(w, sendErr.Code, sendErr.Message, nil)
+		return
+	}
+	if strings.Contains(msg, MockShieldWord) {
+		writeJSON(w, 0, "f", map[string]interface{}{})
+		return
+	}
+	if s.hasShieldKeyword(msg) {
+		writeJSON(w, 0, "k", map[string]interface{}{})
+		return
+	}
+	replyMid, _ := strconv.ParseUint(r.FormValue("reply_mid"), 10, 64)
+	s.PushReplyDanmu(MockUID, MockUName, msg, replyMid)
+	writeJSON(w, 0, "", map[string]interface{}{})
+}
+
+// mockEmoticons 模拟的表情，key为EmoticonUnique
+var mockEmoticons = map[string]api.Emoticon{
+	"official_101": {Emoji: "[dog]", Descript: "狗头", EmoticonUnique: "official_101", Perm: 1},
+	"official_102": {Emoji: "[妙啊]", Descript: "妙啊", EmoticonUnique: "official_102", Perm: 1},
+	"room_7777_1":  {Emoji: "[模拟直播间_打call]", Descript: "打call", EmoticonUnique: "room_7777_1", UnlockShowText: "粉丝勋章3级解锁"},
+}
+
+func (s *Server) handleEmoticons(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	official := api.EmoticonPackage{PkgID: 1, PkgName: "通用表情", PkgType: 1}
+	room := api.EmoticonPackage{PkgID: 2, PkgName: "房间专属表情", PkgType: 2}
+	for _, unique := range []string{"official_101", "official_102"} {
+		official.Emoticons = append(official.Emoticons, mockEmoticons[unique])
+	}
+	room.Emoticons = append(room.Emoticons, mockEmoticons["room_7777_1"])
+	writeJSON(w, 0, "0", map[string]interface{}{"data": []api.EmoticonPackage{official, room}})
+}
+
+func (s *Server) handleInfoByRoom(w http.ResponseWriter, r *http.Request) {
+	if !s.checkWbi(w, r) {
+		return
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"like_info_v3": map[string]interface{}{"total_likes": s.Likes()},
+	})
+}
+
+// handleLikeReport 累加点赞数并推送LIKE_INFO_V3_UPDATE
+func (s *Server) handleLikeReport(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	r.ParseForm()
+	if r.FormValue("csrf") != MockCSRF {
+		writeJSON(w, -111, "csrf 校验失败", nil)
+		return
+	}
+	clickTime, _ := strconv.Atoi(r.FormValue("click_time"))
+	if clickTime <= 0 {
+		writeJSON(w, -400, "参数错误", nil)
+		return
+	}
+	s.mu.Lock()
+	s.likes += int64(clickTime)
+	likes := s.likes
+	s.mu.Unlock()
+	s.Push(CmdMsg(api.CmdLikeInfoV3Update, map[string]interface{}{"click_count": likes}))
+	writeJSON(w, 0, "0", map[string]interface{}{})
+}
+
+func (s *Server) handleQRCodeGenerate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.pollCount = 0
+	s.mu.Unlock()
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"url":        s.URL() + "/qrcode?key=" + mockQRCodeKey,
+		"qrcode_key": mockQRCodeKey,
+	})
+}
+
+// handleQRCodePoll 第一次轮询未扫码，第二次未确认，之后登录成功
+func (s *Server) handleQRCodePoll(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("qrcode_key") != mockQRCodeKey {
+		writeJSON(w, 0, "0", map[string]interface{}{"code": api.QRLoginExpired, "message": "二维码已失效"})
+		return
+	}
+	s.mu.Lock()
+	s.pollCount++
+	pollCount := s.pollCount
+	s.mu.Unlock()
+	switch pollCount {
+	case 1:
+		writeJSON(w, 0, "0", map[string]interface{}{"code": api.QRLoginNotScan, "message": "未扫码"})
+	case 2:
+		writeJSON(w, 0, "0", map[string]interface{}{"code": api.QRLoginNotConfirm, "message": "二维码已扫码未确认"})
+	default:
+		expires := time.Now().Add(180 * 24 * time.Hour)
+		for name, value := range map[string]string{
+			"SESSDATA":   MockSessData,
+			"bili_jct":   MockCSRF,
+			"DedeUserID": "10086",
+		} {
+			http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: "/", Expires: expires})
+		}
+		writeJSON(w, 0, "0", map[string]interface{}{
+			"url":           s.URL(),
+			"refresh_token": "mock_refresh_token",
+			"timestamp":     time.Now().UnixMilli(),
+			"code":          api.QRLoginSuccess,
+			"message":       "",
+		})
+	}
+}
+
+func (s *Server) handleNav(w http.ResponseWriter, r *http.Request) {
+	imgKey, subKey := s.wbiKeys()
+	wbiImg := api.WbiImg{
+		ImgURL: s.URL() + "/bfs/wbi/" + imgKey + ".png",
+		SubURL: s.URL() + "/bfs/wbi/" + subKey + ".png",
+	}
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", map[string]interface{}{"isLogin": false, "wbi_img": wbiImg})
+		return
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{
+		"isLogin": true,
+		"mid":     MockUID,
+		"uname":   MockUName,
+		"wbi_img": wbiImg,
+	})
+}
+
+func (s *Server) handleGetCoin(w http.ResponseWriter, r *http.Request) {
+	if !isLogin(r) {
+		writeJSON(w, -101, "账号未登录", nil)
+		return
+	}
+	writeJSON(w, 0, "0", map[string]interface{}{"money": 100})
+}
+
+func (s *Server) handleSpi(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 0, "ok", map[string]interface{}{
+		"b_3": MockBuvid3,
+		"b_4": MockBuvid4,
+	})
+}
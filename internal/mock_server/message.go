@@ -0,0 +1,46 @@
+package mock_server
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// DanmuMsg 生成一条和线上格式一致的DANMU_MSG消息
+func DanmuMsg(uid uint64, uName string, content string, sendTime time.Time) []byte {
+	return DanmuReplyMsg(uid, uName, content, sendTime, 0, "")
+}
+
+// DanmuReplyMsg 回复replyMid的弹幕，replyMid为0时就是普通弹幕，弹幕id按发送时间生成
+func DanmuReplyMsg(uid uint64, uName string, content string, sendTime time.Time, replyMid uint64, replyUName string) []byte {
+	extra := map[string]interface{}{
+		"id_str":  strconv.FormatInt(sendTime.UnixNano(), 16),
+		"content": content,
+	}
+	if replyMid != 0 {
+		extra["reply_mid"] = replyMid
+		extra["reply_uname"] = replyUName
+	}
+	extraStr, _ := json.Marshal(extra)
+	basicInfo := []interface{}{
+		0, 1, 25, 16777215, sendTime.UnixMilli(), sendTime.Unix(), 0, "", 0, 0, 0, "", 0, "{}", "{}",
+		map[string]interface{}{"mode": 0, "extra": string(extraStr)},
+	}
+	userInfo := []interface{}{uid, uName, 0, 0, 0, 10000, 1, ""}
+	medalInfo := []interface{}{}
+	msg := map[string]interface{}{
+		"cmd":  "DANMU_MSG",
+		"info": []interface{}{basicInfo, content, userInfo, medalInfo, []interface{}{0, 0, 9868950, ">50000", 0}, []interface{}{"", ""}, 0, 0, nil},
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// CmdMsg 生成一条data格式的消息，比如SEND_GIFT、INTERACT_WORD
+func CmdMsg(cmd string, data map[string]interface{}) []byte {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"cmd":  cmd,
+		"data": data,
+	})
+	return msg
+}
@@ -0,0 +1,238 @@
+package mock_server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Proxy 本地模拟的代理服务器，同一个端口同时支持http代理和socks5，
+// 记录客户端请求连接的地址，并按Hosts把域名换成本地地址后转发
+type Proxy struct {
+	// Hosts 目标地址的替换表，key和value都是host:port，没有的地址原样连接
+	Hosts    map[string]string
+	User     string
+	Password string
+
+	listener net.Listener
+	mu       sync.Mutex
+	targets  []string
+	wg       sync.WaitGroup
+}
+
+func StartProxy() (p *Proxy, err error) {
+	p = &Proxy{Hosts: make(map[string]string)}
+	if p.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, err
+	}
+	p.wg.Add(1)
+	go p.accept()
+	return
+}
+
+func (p *Proxy) Close() error {
+	err := p.listener.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Targets 客户端通过代理请求过的地址，按先后顺序
+func (p *Proxy) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.targets...)
+}
+
+func (p *Proxy) accept() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go p.serve(conn)
+	}
+}
+
+// dialTarget 记录并连接目标地址
+func (p *Proxy) dialTarget(addr string) (net.Conn, error) {
+	p.mu.Lock()
+	p.targets = append(p.targets, addr)
+	if mapped, ok := p.Hosts[addr]; ok {
+		addr = mapped
+	}
+	p.mu.Unlock()
+	return net.DialTimeout("tcp", addr, time.Second)
+}
+
+func (p *Proxy) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	first, err := br.Peek(1)
+	if err != nil {
+		return
+	}
+	var target net.Conn
+	if first[0] == 5 {
+		target, err = p.serveSocks(conn, br)
+	} else {
+		target, err = p.serveHTTP(conn, br)
+	}
+	if err != nil || target == nil {
+		return
+	}
+	defer target.Close()
+	go func() {
+		io.Copy(target, br)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+}
+
+func (p *Proxy) checkAuth(user, password string) bool {
+	return p.User == "" || (user == p.User && password == p.Password)
+}
+
+func (p *Proxy) serveHTTP(conn net.Conn, br *bufio.Reader) (target net.Conn, err error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	user, password, _ := (&http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}).BasicAuth()
+	if !p.checkAuth(user, password) {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	if req.Method == http.MethodConnect {
+		if target, err = p.dialTarget(req.Host); err != nil {
+			io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+			return
+		}
+		_, err = io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		return
+	}
+	// 普通http请求是完整的url，转发一次后关闭连接
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	if target, err = p.dialTarget(addr); err != nil {
+		io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	req.Header.Del("Proxy-Authorization")
+	req.Close = true
+	if err = req.Write(target); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return
+}
+
+func (p *Proxy) serveSocks(conn net.Conn, br *bufio.Reader) (target net.Conn, err error) {
+	head := make([]byte, 2)
+	if _, err = io.ReadFull(br, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err = io.ReadFull(br, methods); err != nil {
+		return
+	}
+	method := byte(0)
+	if p.User != "" {
+		method = 2
+	}
+	accepted := false
+	for _, m := range methods {
+		accepted = accepted || m == method
+	}
+	if !accepted {
+		conn.Write([]byte{5, 0xFF})
+		return
+	}
+	conn.Write([]byte{5, method})
+	if method == 2 {
+		var user, password string
+		if user, password, err = readSocksAuth(br); err != nil {
+			return
+		}
+		if !p.checkAuth(user, password) {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err = io.ReadFull(br, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if req[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err = io.ReadFull(br, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		var l byte
+		if l, err = br.ReadByte(); err != nil {
+			return
+		}
+		name := make([]byte, l)
+		if _, err = io.ReadFull(br, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return nil, errors.New("unknown socks address type")
+	}
+	port := make([]byte, 2)
+	if _, err = io.ReadFull(br, port); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+	if target, err = p.dialTarget(addr); err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	_, err = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return
+}
+
+func readSocksAuth(br *bufio.Reader) (user, password string, err error) {
+	readString := func() (s string, err error) {
+		var l byte
+		if l, err = br.ReadByte(); err != nil {
+			return
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(br, b)
+		return string(b), err
+	}
+	if _, err = br.ReadByte(); err != nil {
+		return
+	}
+	if user, err = readString(); err != nil {
+		return
+	}
+	password, err = readString()
+	return
+}
@@ -0,0 +1,256 @@
+// Package mock_server 本地模拟的B站直播服务器，提供客户端用到的HTTP接口和弹幕服务器，
+// 用于离线开发和测试
+package mock_server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+const (
+	MockToken     = "mock_token"
+	MockSessData  = "mock_sessdata"
+	MockCSRF      = "mock_csrf"
+	MockUID       = 10086
+	MockUName     = "模拟用户"
+	MockOwnerUID  = 10000
+	MockImgKey    = "7cd084941338484aae1ad9425b84077c"
+	MockSubKey    = "4932caff0ff746eab6f01bf08b70ac45"
+	MockBuvid3    = "D2F1C5E7-1A2B-3C4D-5E6F-7A8B9C0D1E2Finfoc"
+	MockBuvid4    = "5A6B7C8D-9E0F-1A2B-3C4D-5E6F7A8B9C0D-mock"
+	mockQRCodeKey = "mock_qrcode_key"
+	// MockShieldWord 包含这个词的弹幕和真实服务器一样返回code 0、message f
+	MockShieldWord = "屏蔽词"
+	// MockLikes 房间初始的点赞总数
+	MockLikes = 1000
+)
+
+type Server struct {
+	RoomID  uint64
+	ShortID uint64
+	Title   string
+	// DanmuLength 登录用户的弹幕长度限制
+	DanmuLength int
+	// SendInterval 两条弹幕之间的最短间隔，发太快返回10030，为0时不限制
+	SendInterval time.Duration
+	// RoomAdmin 模拟用户是不是房管，默认是
+	RoomAdmin bool
+
+	httpListener  net.Listener
+	danmuListener net.Listener
+	httpServer    *http.Server
+
+	mu         sync.Mutex
+	conns      map[*danmuConn]struct{}
+	pollCount  int
+	imgKey     string
+	authBuvids []string
+	subKey     string
+	doneChan   chan struct{}
+	closeOnce  sync.Once
+	popularity uint32
+	sendErr    *api.APIError
+	lastSendAt time.Time
+	users      map[uint64]string
+	wallet     api.Wallet
+	bag        []api.BagGift
+	likes      int64
+	silent     []api.SilentUser
+	keywords   []string
+}
+
+// Start 在127.0.0.1的随机端口上启动HTTP和弹幕服务器
+func Start() (s *Server, err error) {
+	s = &Server{
+		RoomID:      7777,
+		ShortID:     0,
+		Title:       "模拟直播间",
+		DanmuLength: 20,
+		RoomAdmin:   true,
+		conns:       make(map[*danmuConn]struct{}),
+		users:       make(map[uint64]string),
+		doneChan:    make(chan struct{}),
+		popularity:  1,
+		imgKey:      MockImgKey,
+		subKey:      MockSubKey,
+		wallet:      api.Wallet{Gold: MockGold, Silver: 1000},
+		bag:         newMockBag(),
+		likes:       MockLikes,
+	}
+	if s.httpListener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, err
+	}
+	if s.danmuListener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		s.httpListener.Close()
+		return nil, err
+	}
+	s.httpServer = &http.Server{Handler: s.routes()}
+	go s.httpServer.Serve(s.httpListener)
+	go s.acceptDanmu()
+	return
+}
+
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.doneChan)
+		s.httpServer.Close()
+		s.danmuListener.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+func (s *Server) URL() string {
+	return "http://" + s.httpListener.Addr().String()
+}
+
+// BaseURLs 所有接口都由同一个HTTP服务器提供
+func (s *Server) BaseURLs() api.BaseURLs {
+	url := s.URL()
+	return api.BaseURLs{
+		Live:      url,
+		Main:      url,
+		Passport:  url,
+		Account:   url,
+		LiveTrace: url,
+	}
+}
+
+func (s *Server) DanmuHost() api.DanmuHost {
+	addr := s.danmuListener.Addr().(*net.TCPAddr)
+	return api.DanmuHost{Host: addr.IP.String(), Port: addr.Port}
+}
+
+// ConnCount 当前已认证的弹幕连接数
+func (s *Server) ConnCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Push 向所有已认证的弹幕连接推送一条消息，body是完整的消息json
+func (s *Server) Push(body []byte) {
+	s.mu.Lock()
+	conns := make([]*danmuConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+	for _, conn := range conns {
+		conn.push(body)
+	}
+}
+
+// CloseConns 断开所有弹幕连接，用于测试重连
+func (s *Server) CloseConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// AuthBuvids 弹幕连接认证时带上的buvid，按认证的先后顺序
+func (s *Server) AuthBuvids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.authBuvids...)
+}
+
+// SetWbiKeys 更换WBI签名的key，之前的签名都会失效，用于测试客户端刷新key
+func (s *Server) SetWbiKeys(imgKey, subKey string) {
+	s.mu.Lock()
+	s.imgKey, s.subKey = imgKey, subKey
+	s.mu.Unlock()
+}
+
+// Likes 房间收到的点赞总数
+func (s *Server) Likes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.likes
+}
+
+// SetSendError 之后发送弹幕都返回这个错误，code为0时恢复正常
+func (s *Server) SetSendError(code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendErr = nil
+	if code != 0 {
+		s.sendErr = &api.APIError{Code: code, Message: message}
+	}
+}
+
+func (s *Server) wbiKeys() (imgKey, subKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.imgKey, s.subKey
+}
+
+// PushDanmu 推送一条普通弹幕
+func (s *Server) PushDanmu(uid uint64, uName string, content string) {
+	s.PushReplyDanmu(uid, uName, content, 0)
+}
+
+// PushReplyDanmu 推送一条回复replyMid的弹幕，被回复的用户名取自之前推送过的弹幕
+func (s *Server) PushReplyDanmu(uid uint64, uName string, content string, replyMid uint64) {
+	s.mu.Lock()
+	s.users[uid] = uName
+	replyUName := s.users[replyMid]
+	s.mu.Unlock()
+	s.Push(DanmuReplyMsg(uid, uName, content, time.Now(), replyMid, replyUName))
+}
+
+// AutoDanmu 每隔interval推送一条随机弹幕，直到服务器关闭
+func (s *Server) AutoDanmu(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for n := 1; ; n++ {
+			select {
+			case <-s.doneChan:
+				return
+			case <-ticker.C:
+				uid := uint64(20000 + n%7)
+				s.PushDanmu(uid, "观众"+strconv.FormatUint(uid, 10), fmt.Sprintf("这是第%d条模拟弹幕", n))
+			}
+		}
+	}()
+}
+
+func (s *Server) acceptDanmu() {
+	for {
+		conn, err := s.danmuListener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		go s.serveDanmu(conn)
+	}
+}
+
+func (s *Server) addConn(conn *danmuConn) {
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Server) removeConn(conn *danmuConn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
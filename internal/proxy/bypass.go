@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+)
+
+// bypassRule 绕过代理的规则，写法和NO_PROXY环境变量一致：
+// "*"匹配所有地址，"10.0.0.0/8"匹配网段，"example.com"匹配域名本身和子域名，
+// ".example.com"只匹配子域名，可以带上端口只匹配这个端口
+type bypassRule struct {
+	all    bool
+	ipNet  *net.IPNet
+	ip     net.IP
+	domain string
+	suffix bool
+	port   string
+}
+
+func parseBypassRule(rule string) (r bypassRule, ok bool) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule == "" {
+		return
+	}
+	if rule == "*" {
+		return bypassRule{all: true}, true
+	}
+	if _, ipNet, err := net.ParseCIDR(rule); err == nil {
+		return bypassRule{ipNet: ipNet}, true
+	}
+	if host, port, err := net.SplitHostPort(rule); err == nil {
+		rule, r.port = host, port
+	}
+	if ip := net.ParseIP(rule); ip != nil {
+		r.ip = ip
+		return r, true
+	}
+	if strings.HasPrefix(rule, "*.") {
+		rule = rule[1:]
+	}
+	r.suffix = strings.HasPrefix(rule, ".")
+	r.domain = strings.TrimPrefix(strings.TrimSuffix(rule, "."), ".")
+	return r, r.domain != ""
+}
+
+func (r bypassRule) match(host string, ip net.IP, port string) bool {
+	switch {
+	case r.all:
+		return true
+	case r.port != "" && r.port != port:
+		return false
+	case r.ipNet != nil:
+		return ip != nil && r.ipNet.Contains(ip)
+	case r.ip != nil:
+		return ip != nil && r.ip.Equal(ip)
+	case ip != nil:
+		return false
+	case host == r.domain:
+		return !r.suffix
+	}
+	return strings.HasSuffix(host, "."+r.domain)
+}
@@ -0,0 +1,334 @@
+// Package proxy 接口请求和弹幕连接共用的代理设置，支持http、https和socks5代理
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	UnsupportedSchemeErr = errors.New("unsupported proxy scheme")
+	ConnectFailedErr     = errors.New("proxy connect failed")
+	SocksAuthFailedErr   = errors.New("socks5 auth failed")
+)
+
+// Dialer 按绕过规则决定直连还是经过代理，零值和nil都是直连
+type Dialer struct {
+	url    *url.URL
+	bypass []bypassRule
+	direct net.Dialer
+}
+
+// New 解析代理地址和绕过规则，rawURL为空时返回nil，表示不使用代理
+func New(rawURL string, noProxy []string) (d *Dialer, err error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%w: %q", UnsupportedSchemeErr, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy host missing: %q", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), defaultPort(u.Scheme))
+	}
+	d = &Dialer{url: u}
+	for _, rule := range noProxy {
+		if r, ok := parseBypassRule(rule); ok {
+			d.bypass = append(d.bypass, r)
+		}
+	}
+	return
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return "1080"
+}
+
+func (d *Dialer) String() string {
+	if d == nil {
+		return "direct"
+	}
+	u := *d.url
+	u.User = nil
+	return u.String()
+}
+
+// UseProxy addr是否需要经过代理，回环地址总是直连
+func (d *Dialer) UseProxy(addr string) bool {
+	if d == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return false
+	}
+	for _, rule := range d.bypass {
+		if rule.match(host, ip, port) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Dialer) Dial(network, addr string, timeout time.Duration) (conn net.Conn, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, addr)
+}
+
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	if !d.UseProxy(addr) {
+		var direct net.Dialer
+		if d != nil {
+			direct = d.direct
+		}
+		return direct.DialContext(ctx, network, addr)
+	}
+	conn, err = d.direct.DialContext(ctx, "tcp", d.url.Host)
+	if err != nil {
+		return
+	}
+	// 握手期间ctx取消或超时要能打断阻塞的读写
+	raw := conn
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		raw.SetDeadline(time.Now())
+	})
+	defer func() {
+		if !stop() && err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			raw.Close()
+			conn = nil
+			return
+		}
+		raw.SetDeadline(time.Time{})
+	}()
+	switch d.url.Scheme {
+	case "socks5", "socks5h":
+		err = d.socksConnect(conn, addr)
+	case "https":
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.url.Hostname()})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return
+		}
+		conn = tlsConn
+		err = d.httpConnect(conn, addr)
+	default:
+		err = d.httpConnect(conn, addr)
+	}
+	return
+}
+
+// Transport 在http.DefaultTransport的基础上设置代理，d为nil时保持默认行为
+func (d *Dialer) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if d == nil {
+		return transport
+	}
+	switch d.url.Scheme {
+	case "http", "https":
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if !d.UseProxy(canonicalAddr(req.URL)) {
+				return nil, nil
+			}
+			return d.url, nil
+		}
+	default:
+		transport.Proxy = nil
+		transport.DialContext = d.DialContext
+	}
+	return transport
+}
+
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func (d *Dialer) proxyAuth() string {
+	if d.url.User == nil {
+		return ""
+	}
+	password, _ := d.url.User.Password()
+	auth := d.url.User.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+}
+
+// httpConnect 用CONNECT方法建立隧道
+func (d *Dialer) httpConnect(conn net.Conn, addr string) (err error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if auth := d.proxyAuth(); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err = req.Write(conn); err != nil {
+		return
+	}
+	// 隧道建立前代理不会多发数据，这里逐字节读响应头，避免读多了丢掉后面的数据
+	resp, err := http.ReadResponse(bufio.NewReaderSize(oneByteReader{conn}, 1), req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%w, status=%s", ConnectFailedErr, resp.Status)
+	}
+	return
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.r.Read(p)
+}
+
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksPasswordAuth = 2
+	socksCmdConnect   = 1
+	socksAtypIPv4     = 1
+	socksAtypDomain   = 3
+	socksAtypIPv6     = 4
+)
+
+// socksConnect socks5握手，域名交给代理解析
+func (d *Dialer) socksConnect(conn net.Conn, addr string) (err error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 0xFFFF {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	method := byte(socksNoAuth)
+	if d.url.User != nil {
+		method = socksPasswordAuth
+	}
+	if _, err = conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return
+	}
+	var reply [2]byte
+	if _, err = io.ReadFull(conn, reply[:]); err != nil {
+		return
+	}
+	if reply[0] != socksVersion || reply[1] != method {
+		return fmt.Errorf("%w, method=%d", SocksAuthFailedErr, reply[1])
+	}
+	if method == socksPasswordAuth {
+		username := d.url.User.Username()
+		password, _ := d.url.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return SocksAuthFailedErr
+		}
+		req := []byte{1, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err = conn.Write(req); err != nil {
+			return
+		}
+		if _, err = io.ReadFull(conn, reply[:]); err != nil {
+			return
+		}
+		if reply[1] != 0 {
+			return SocksAuthFailedErr
+		}
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host too long: %q", host)
+		}
+		req = append(req, socksAtypDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAtypIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socksAtypIPv6)
+		req = append(req, ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = conn.Write(req); err != nil {
+		return
+	}
+
+	var head [4]byte
+	if _, err = io.ReadFull(conn, head[:]); err != nil {
+		return
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("%w, reply=%d", ConnectFailedErr, head[1])
+	}
+	// 跳过代理返回的绑定地址
+	var skip int
+	switch head[3] {
+	case socksAtypIPv4:
+		skip = net.IPv4len
+	case socksAtypIPv6:
+		skip = net.IPv6len
+	case socksAtypDomain:
+		var l [1]byte
+		if _, err = io.ReadFull(conn, l[:]); err != nil {
+			return
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("%w, atyp=%d", ConnectFailedErr, head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return
+}
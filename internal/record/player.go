@@ -0,0 +1,119 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+var noMessageErr = errors.New("no message in record file")
+
+// ReadEntries 读取会话文件中解码后的消息，切分后被压缩的.gz文件也可以直接读取
+func ReadEntries(fileName string) (entries []Entry, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(fileName, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	br := bufio.NewReader(r)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry Entry
+			if err = json.Unmarshal(line, &entry); err != nil {
+				return nil, err
+			}
+			if entry.Msg != nil {
+				entries = append(entries, entry)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if len(entries) == 0 {
+		err = noMessageErr
+	}
+	return
+}
+
+// Player 按录制时的时间间隔回放消息，Speed为0时每次Step只放一条
+type Player struct {
+	entries  []Entry
+	Speed    float64
+	stepChan chan struct{}
+}
+
+func NewPlayer(entries []Entry, speed float64) *Player {
+	return &Player{
+		entries:  entries,
+		Speed:    speed,
+		stepChan: make(chan struct{}, 1),
+	}
+}
+
+func (p *Player) StepMode() bool {
+	return p.Speed <= 0
+}
+
+func (p *Player) Len() int {
+	return len(p.entries)
+}
+
+// Step 单步模式下放出下一条消息
+func (p *Player) Step() {
+	select {
+	case p.stepChan <- struct{}{}:
+	default:
+	}
+}
+
+// Play 把消息依次写入out，全部放完或者done关闭时返回
+func (p *Player) Play(out chan<- *api.DanmuMessage, done <-chan struct{}) {
+	for n, entry := range p.entries {
+		if p.StepMode() {
+			select {
+			case <-done:
+				return
+			case <-p.stepChan:
+			}
+		} else if n > 0 {
+			delay := time.Duration(float64(entry.Time-p.entries[n-1].Time) / p.Speed * float64(time.Millisecond))
+			if delay > 0 {
+				select {
+				case <-done:
+					return
+				case <-time.After(delay):
+				}
+			}
+		}
+		danmuMessage := new(api.DanmuMessage)
+		if err := json.Unmarshal(entry.Msg, danmuMessage); err != nil {
+			continue
+		}
+		danmuMessage.Raw = entry.Msg
+		select {
+		case <-done:
+			return
+		case out <- danmuMessage:
+		}
+	}
+}
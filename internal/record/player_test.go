@@ -0,0 +1,73 @@
+package record
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shr-go/bili_live_tui/api"
+)
+
+func writeSession(t *testing.T) string {
+	fileName := filepath.Join(t.TempDir(), "danmu.rec")
+	recorder := NewRecorder(Options{FileName: fileName})
+	recorder.RecordRaw([]byte{0, 0, 0, 16})
+	recorder.write(&Entry{Time: 1000, Cmd: "DANMU_MSG", Msg: []byte(`{"cmd":"DANMU_MSG","info":[[],"first"]}`)})
+	recorder.write(&Entry{Time: 1200, Cmd: "DANMU_MSG", Msg: []byte(`{"cmd":"DANMU_MSG","info":[[],"second"]}`)})
+	recorder.write(&Entry{Time: 1400, Cmd: "SUPER_CHAT_MESSAGE", Msg: []byte(`{"cmd":"SUPER_CHAT_MESSAGE","data":{"price":30}}`)})
+	recorder.Close()
+	return fileName
+}
+
+func TestPlayerSpeed(t *testing.T) {
+	entries, err := ReadEntries(writeSession(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("raw entries should be skipped, got %d entries", len(entries))
+	}
+
+	out := make(chan *api.DanmuMessage, 10)
+	start := time.Now()
+	NewPlayer(entries, 10).Play(out, nil)
+	// 原本间隔400ms，10倍速应该在40ms左右放完
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("10x replay took %v", elapsed)
+	}
+	close(out)
+	var cmds []string
+	for msg := range out {
+		cmds = append(cmds, msg.Cmd)
+	}
+	if len(cmds) != 3 || cmds[2] != "SUPER_CHAT_MESSAGE" {
+		t.Errorf("unexpected replay result %v", cmds)
+	}
+}
+
+func TestPlayerStep(t *testing.T) {
+	entries, err := ReadEntries(writeSession(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan *api.DanmuMessage, 10)
+	done := make(chan struct{})
+	player := NewPlayer(entries, 0)
+	go player.Play(out, done)
+	defer close(done)
+
+	select {
+	case <-out:
+		t.Fatalf("step mode should wait for Step")
+	case <-time.After(50 * time.Millisecond):
+	}
+	player.Step()
+	select {
+	case msg := <-out:
+		if msg.Info[1] != "first" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no message after Step")
+	}
+}
@@ -0,0 +1,90 @@
+// Package record 把弹幕连接收到的原始数据包和解码后的消息保存成会话文件，用于复现解析问题和回放
+package record
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const defaultMaxSize = 50
+
+// Entry 会话文件中的一行，Raw和Msg只会有一个
+type Entry struct {
+	Time int64           `json:"t"`
+	Raw  []byte          `json:"raw,omitempty"`
+	Cmd  string          `json:"cmd,omitempty"`
+	Msg  json.RawMessage `json:"msg,omitempty"`
+}
+
+type Options struct {
+	FileName string
+	// MaxSize 单个文件最大多少MB，超过后切分，旧文件会被gzip压缩
+	MaxSize int
+	// RotateOnLive 开播时切分文件，每场直播单独一个文件
+	RotateOnLive bool
+	// SkipRaw 只保存解码后的消息
+	SkipRaw bool
+}
+
+type Recorder struct {
+	mu       sync.Mutex
+	writer   *lumberjack.Logger
+	options  Options
+	encoding []byte
+}
+
+func NewRecorder(options Options) *Recorder {
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultMaxSize
+	}
+	return &Recorder{
+		writer: &lumberjack.Logger{
+			Filename: options.FileName,
+			MaxSize:  options.MaxSize,
+			Compress: true,
+		},
+		options: options,
+	}
+}
+
+func (r *Recorder) write(entry *Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoding = append(append(r.encoding[:0], line...), '\n')
+	r.writer.Write(r.encoding)
+}
+
+// RecordRaw 保存一次从连接上读到的原始数据
+func (r *Recorder) RecordRaw(data []byte) {
+	if r.options.SkipRaw {
+		return
+	}
+	r.write(&Entry{Time: time.Now().UnixMilli(), Raw: data})
+}
+
+// RecordMessage 保存一条解压后的消息json
+func (r *Recorder) RecordMessage(cmd string, data []byte) {
+	if r.options.RotateOnLive && cmd == "LIVE" {
+		r.Rotate()
+	}
+	r.write(&Entry{Time: time.Now().UnixMilli(), Cmd: cmd, Msg: data})
+}
+
+func (r *Recorder) Rotate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writer.Rotate()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writer.Close()
+}
@@ -0,0 +1,64 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "danmu.rec")
+	recorder := NewRecorder(Options{FileName: fileName})
+	recorder.RecordRaw([]byte{0, 0, 0, 16})
+	recorder.RecordMessage("DANMU_MSG", []byte(`{"cmd":"DANMU_MSG","info":[]}`))
+	recorder.Close()
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid line %q, err=%v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if string(entries[0].Raw) != string([]byte{0, 0, 0, 16}) || entries[0].Msg != nil {
+		t.Errorf("raw entry mismatch, %+v", entries[0])
+	}
+	if entries[1].Cmd != "DANMU_MSG" || string(entries[1].Msg) != `{"cmd":"DANMU_MSG","info":[]}` {
+		t.Errorf("message entry mismatch, %+v", entries[1])
+	}
+}
+
+func TestRecorderRotateOnLive(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewRecorder(Options{FileName: filepath.Join(dir, "danmu.rec"), RotateOnLive: true, SkipRaw: true})
+	recorder.RecordRaw([]byte{1})
+	recorder.RecordMessage("PREPARING", []byte(`{"cmd":"PREPARING"}`))
+	recorder.RecordMessage("LIVE", []byte(`{"cmd":"LIVE"}`))
+	recorder.Close()
+
+	// 切分出来的旧文件会在后台压缩，等压缩完再检查，否则TempDir清理时文件还在写
+	var files []string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		files, _ = filepath.Glob(filepath.Join(dir, "danmu*.rec*"))
+		if len(files) == 2 && (strings.HasSuffix(files[0], ".gz") || strings.HasSuffix(files[1], ".gz")) {
+			break
+		}
+	}
+	if len(files) != 2 {
+		t.Errorf("expected a new file for the live session, got %v", files)
+	}
+}
@@ -0,0 +1,274 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+)
+
+// adminPanelRows 管理面板一页显示几条
+const adminPanelRows = 8
+
+var muteOptions = []struct {
+	label string
+	hour  int
+}{
+	{"本场直播", api.MuteHourThisLive},
+	{"1小时", 1},
+	{"24小时", 24},
+	{"7天", 7 * 24},
+	{"永久", api.MuteHourForever},
+}
+
+type adminLoaded struct {
+	muted    []api.SilentUser
+	keywords []api.ShieldKeyword
+	err      error
+}
+
+// adminDone 禁言、解除禁言和修改屏蔽词的结果
+type adminDone struct {
+	text string
+	err  error
+}
+
+func moderate(text string, f func() error) tea.Cmd {
+	return func() tea.Msg {
+		return &adminDone{text: text, err: f()}
+	}
+}
+
+func loadAdmin(room *api.LiveRoom) tea.Cmd {
+	return func() tea.Msg {
+		muted, err := live_room.GetAllMutedUsers(room.Context(), room)
+		if err != nil {
+			return &adminLoaded{err: err}
+		}
+		keywords, err := live_room.GetShieldKeywords(room.Context(), room)
+		if err != nil {
+			return &adminLoaded{err: err}
+		}
+		return &adminLoaded{muted: muted, keywords: keywords.Data.KeywordList}
+	}
+}
+
+// muteDialog 在弹幕区域选中弹幕后按m打开，选择禁言时长
+type muteDialog struct {
+	target     *danmuMsg
+	option     int
+	confirmYes bool
+}
+
+func (d *muteDialog) show(target *danmuMsg) {
+	d.target = target
+	d.option = 0
+	d.confirmYes = false
+}
+
+func (d *muteDialog) update(msg tea.KeyMsg, room *api.LiveRoom) (cmd tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		d.option = max(0, d.option-1)
+	case "down", "j":
+		d.option = min(len(muteOptions)-1, d.option+1)
+	case "left", "right", "tab":
+		d.confirmYes = !d.confirmYes
+	case "enter", " ":
+		if d.confirmYes {
+			target, option := d.target, muteOptions[d.option]
+			text := fmt.Sprintf("已禁言%s（%s）", target.uName, option.label)
+			cmd = moderate(text, func() error {
+				return live_room.MuteUser(room.Context(), room, target.uid, option.hour)
+			})
+		}
+		d.target = nil
+	case "esc":
+		d.target = nil
+	}
+	return
+}
+
+func (d *muteDialog) view(width, height int) string {
+	var options []string
+	for i, option := range muteOptions {
+		options = append(options, selectableRow(option.label, i == d.option))
+	}
+	question := fmt.Sprintf("禁言 %s: %s", d.target.uName, d.target.content)
+	return confirmView(question, "禁言", d.confirmYes, width, height, "", lipgloss.JoinVertical(lipgloss.Left, options...))
+}
+
+// adminPanel 禁言列表和屏蔽词，tab切换，d删除，屏蔽词页按a添加
+type adminPanel struct {
+	open        bool
+	loaded      bool
+	showKeyword bool
+	muted       []api.SilentUser
+	keywords    []api.ShieldKeyword
+	cursor      int
+	confirming  bool
+	confirmYes  bool
+	adding      bool
+	input       textinput.Model
+}
+
+func newAdminPanel() adminPanel {
+	input := textinput.New()
+	input.Placeholder = "输入要添加的屏蔽词"
+	input.CharLimit = 20
+	return adminPanel{input: input}
+}
+
+func (p *adminPanel) show() {
+	p.open = true
+	p.confirming = false
+	p.adding = false
+}
+
+func (p *adminPanel) hide() {
+	p.open = false
+	p.input.Blur()
+}
+
+// setData 确认框打开时列表也可能被刷新，之后用cursor取元素前都要检查范围
+func (p *adminPanel) setData(msg *adminLoaded) {
+	p.muted, p.keywords = msg.muted, msg.keywords
+	p.loaded = true
+	p.cursor = min(p.cursor, max(0, p.len()-1))
+	if p.cursor >= p.len() {
+		p.confirming = false
+	}
+}
+
+func (p *adminPanel) len() int {
+	if p.showKeyword {
+		return len(p.keywords)
+	}
+	return len(p.muted)
+}
+
+func (p *adminPanel) update(msg tea.KeyMsg, room *api.LiveRoom) (cmd tea.Cmd) {
+	switch {
+	case p.adding:
+		switch msg.String() {
+		case "enter":
+			keyword := strings.TrimSpace(p.input.Value())
+			p.adding = false
+			p.input.Blur()
+			if keyword != "" {
+				cmd = moderate(fmt.Sprintf("已添加屏蔽词%s", keyword), func() error {
+					return live_room.AddShieldKeyword(room.Context(), room, keyword)
+				})
+			}
+		case "esc":
+			p.adding = false
+			p.input.Blur()
+		default:
+			p.input, cmd = p.input.Update(msg)
+		}
+		return
+	case p.confirming:
+		switch msg.String() {
+		case "left", "right", "tab":
+			p.confirmYes = !p.confirmYes
+		case "enter", " ":
+			p.confirming = false
+			if p.confirmYes {
+				cmd = p.remove(room)
+			}
+		case "esc":
+			p.confirming = false
+		}
+		return
+	}
+	switch msg.String() {
+	case "esc", "ctrl+b":
+		p.hide()
+	case "tab":
+		p.showKeyword = !p.showKeyword
+		p.cursor = 0
+	case "up", "k":
+		p.cursor = max(0, p.cursor-1)
+	case "down", "j":
+		p.cursor = max(0, min(p.len()-1, p.cursor+1))
+	case "d", "delete":
+		if p.cursor < p.len() {
+			p.confirming = true
+			p.confirmYes = false
+		}
+	case "a":
+		if p.showKeyword {
+			p.adding = true
+			p.input.Reset()
+			cmd = p.input.Focus()
+		}
+	}
+	return
+}
+
+func (p *adminPanel) remove(room *api.LiveRoom) tea.Cmd {
+	if p.cursor >= p.len() {
+		return nil
+	}
+	if p.showKeyword {
+		keyword := p.keywords[p.cursor].Keyword
+		return moderate(fmt.Sprintf("已删除屏蔽词%s", keyword), func() error {
+			return live_room.DelShieldKeyword(room.Context(), room, keyword)
+		})
+	}
+	user := p.muted[p.cursor]
+	return moderate(fmt.Sprintf("已解除%s的禁言", user.TName), func() error {
+		return live_room.UnmuteUser(room.Context(), room, user.TUID)
+	})
+}
+
+func (p *adminPanel) view(width, height int) string {
+	if p.confirming && p.cursor < p.len() {
+		var question string
+		if p.showKeyword {
+			question = fmt.Sprintf("确定删除屏蔽词%s吗？", p.keywords[p.cursor].Keyword)
+		} else {
+			question = fmt.Sprintf("确定解除%s的禁言吗？", p.muted[p.cursor].TName)
+		}
+		return confirmView(question, "确定", p.confirmYes, width, height)
+	}
+	mutedTab, keywordTab := activeTab.Render("禁言列表"), tab.Render("屏蔽词")
+	if p.showKeyword {
+		mutedTab, keywordTab = tab.Render("禁言列表"), activeTab.Render("屏蔽词")
+	}
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Bottom, mutedTab, keywordTab), ""}
+	switch {
+	case !p.loaded:
+		rows = append(rows, "正在加载...")
+	case p.len() == 0:
+		rows = append(rows, "列表是空的")
+	default:
+		start := p.cursor / adminPanelRows * adminPanelRows
+		end := min(start+adminPanelRows, p.len())
+		for i := start; i < end; i++ {
+			var row string
+			if p.showKeyword {
+				row = fmt.Sprintf("%s %s", p.keywords[i].Keyword, urlStyle(p.keywords[i].Name))
+			} else {
+				user := p.muted[i]
+				row = fmt.Sprintf("%s %s", user.TName, urlStyle("至"+user.BlockEndTime))
+			}
+			rows = append(rows, selectableRow(row, i == p.cursor))
+		}
+	}
+	help := "上下选择 d解除禁言 tab切换 esc关闭"
+	if p.showKeyword {
+		help = "上下选择 a添加 d删除 tab切换 esc关闭"
+	}
+	if p.adding {
+		rows = append(rows, "", p.input.View())
+		help = "回车添加 esc取消"
+	}
+	rows = append(rows, "", help)
+	ui := lipgloss.NewStyle().Width(48).Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return overlayView(ui, width, height)
+}
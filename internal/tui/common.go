@@ -1,20 +1,27 @@
 package tui
 
 import (
+	"context"
+	"fmt"
 	"github.com/BurntSushi/toml"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/shr-go/bili_live_tui/api"
 	"github.com/shr-go/bili_live_tui/internal/live_room"
+	"github.com/shr-go/bili_live_tui/internal/proxy"
+	"github.com/shr-go/bili_live_tui/internal/record"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
 	"golang.org/x/term"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
 var (
 	windowWidth  int
 	windowHeight int
 	LiveConfig   api.BiliLiveConfig
+	cookieFile   = "COOKIE.DAT"
+	buvidFile    = "BUVID.DAT"
 )
 
 func init() {
@@ -27,6 +34,13 @@ func init() {
 	}
 }
 
+// EnableMockMode 所有请求都发往本地模拟服务器，登录信息单独保存，不会覆盖真实账号的cookie
+func EnableMockMode(urls api.BaseURLs) {
+	LiveConfig.BaseURLs = urls
+	cookieFile = "COOKIE_MOCK.DAT"
+	buvidFile = "BUVID_MOCK.DAT"
+}
+
 type userAgentTransport struct {
 	ua string
 	rt http.RoundTripper
@@ -37,25 +51,46 @@ func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error
 	return t.rt.RoundTrip(req)
 }
 
-func GetCustomHttpClient() (client *http.Client) {
+func GetCustomHttpClient() (client *api.Client) {
 	ua := LiveConfig.UserAgent
 	if ua == "" {
 		ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36"
 	}
+	dialer, err := proxy.New(LiveConfig.Proxy, LiveConfig.NoProxy)
+	if err != nil {
+		logging.Fatalf("invalid proxy config, err=%v", err)
+	}
 	transport := &userAgentTransport{
 		ua: ua,
-		rt: http.DefaultTransport,
+		rt: dialer.Transport(),
+	}
+	client = api.NewClient(&http.Client{Transport: transport}, LiveConfig.BaseURLs)
+	client.Logf = logging.Warnf
+	live_room.UseWbi(client)
+	return
+}
+
+// loadBuvid 游客也需要设备标识，第一次运行时申请并保存，之后一直使用同一个
+func loadBuvid(ctx context.Context, client *api.Client) {
+	saved, _ := os.ReadFile(buvidFile)
+	cookie, err := live_room.EnsureBuvid(ctx, client, string(saved))
+	if err != nil {
+		logging.Warnf("get buvid failed, connect without it, err=%v", err)
+		return
 	}
-	return &http.Client{
-		Transport: transport,
+	if cookie != string(saved) {
+		if err = os.WriteFile(buvidFile, []byte(cookie), 0o660); err != nil {
+			logging.Warnf("save buvid failed, err=%v", err)
+		}
 	}
 }
 
-func PrepareEnterRoom(client *http.Client) (room *api.LiveRoom, err error) {
-	loginModel := newLoginModel(client)
-	if cookieBytes, err := os.ReadFile("COOKIE.DAT"); err == nil {
+func PrepareEnterRoom(ctx context.Context, client *api.Client) (room *api.LiveRoom, err error) {
+	loadBuvid(ctx, client)
+	loginModel := newLoginModel(ctx, client)
+	if cookieBytes, err := os.ReadFile(cookieFile); err == nil {
 		cookies := string(cookieBytes)
-		if live_room.CheckCookieValid(client, cookies) {
+		if live_room.CheckCookieValid(ctx, client, cookies) {
 			loginModel.step = loginStepLoginSuccess
 			loginModel.localCookie = true
 		}
@@ -70,3 +105,40 @@ func PrepareEnterRoom(client *http.Client) (room *api.LiveRoom, err error) {
 	}
 	return loginModel.room, nil
 }
+
+// PrepareReplay 读取录制的会话文件，生成一个不需要网络的房间用于回放
+func PrepareReplay(ctx context.Context, fileName string, speed float64) (room *api.LiveRoom, player *record.Player, err error) {
+	entries, err := record.ReadEntries(fileName)
+	if err != nil {
+		return
+	}
+	title := fmt.Sprintf("回放 %s", filepath.Base(fileName))
+	if speed > 0 && speed != 1 {
+		title = fmt.Sprintf("%s (%gx)", title, speed)
+	} else if speed <= 0 {
+		title = fmt.Sprintf("%s (单步，按n播放下一条)", title)
+	}
+	room = &api.LiveRoom{
+		Title:       title,
+		MessageChan: make(chan *api.DanmuMessage, 10),
+		Config:      &LiveConfig,
+		Bus:         live_room.NewRoomBus(),
+	}
+	room.Start(ctx)
+	player = record.NewPlayer(entries, speed)
+	return
+}
+
+func Replay(program *tea.Program, room *api.LiveRoom, player *record.Player) {
+	finished := make(chan struct{})
+	if !room.Go(func() {
+		player.Play(room.MessageChan, room.DoneChan)
+		close(finished)
+	}) {
+		return
+	}
+	<-finished
+	if room.Context().Err() == nil {
+		program.Send(generateSystemMsg(fmt.Sprintf("回放结束，共%d条消息", player.Len())))
+	}
+}
@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+)
+
+// emoticonPickerRows 选择框里一次显示几个表情
+const emoticonPickerRows = 10
+
+type emoticonItem struct {
+	pkgName  string
+	emoticon api.Emoticon
+}
+
+type emoticonLoaded struct {
+	items []emoticonItem
+	err   error
+}
+
+// emoticonPicker 表情选择框，输入文字筛选，上下选择，回车发送
+type emoticonPicker struct {
+	open    bool
+	loaded  bool
+	search  textinput.Model
+	items   []emoticonItem
+	matched []emoticonItem
+	cursor  int
+}
+
+func newEmoticonPicker() emoticonPicker {
+	search := textinput.New()
+	search.Placeholder = "搜索表情"
+	search.Prompt = "🔍 "
+	return emoticonPicker{search: search}
+}
+
+func loadEmoticons(room *api.LiveRoom) tea.Cmd {
+	return func() tea.Msg {
+		resp, err := live_room.GetEmoticons(room.Context(), room.Client, room.RoomID)
+		if err != nil {
+			return &emoticonLoaded{err: err}
+		}
+		var items []emoticonItem
+		for _, pkg := range resp.Data.Data {
+			for _, emoticon := range pkg.Emoticons {
+				// 还没解锁的表情发不出去，不显示
+				if emoticon.Perm == 0 {
+					continue
+				}
+				items = append(items, emoticonItem{pkgName: pkg.PkgName, emoticon: emoticon})
+			}
+		}
+		return &emoticonLoaded{items: items}
+	}
+}
+
+func (p *emoticonPicker) setItems(items []emoticonItem) {
+	p.items = items
+	p.loaded = true
+	p.filter()
+}
+
+func (p *emoticonPicker) filter() {
+	keyword := strings.ToLower(strings.TrimSpace(p.search.Value()))
+	p.matched = p.matched[:0]
+	for _, item := range p.items {
+		text := strings.ToLower(item.pkgName + item.emoticon.Emoji + item.emoticon.Descript)
+		if keyword == "" || strings.Contains(text, keyword) {
+			p.matched = append(p.matched, item)
+		}
+	}
+	p.cursor = min(p.cursor, max(0, len(p.matched)-1))
+}
+
+func (p *emoticonPicker) show() tea.Cmd {
+	p.open = true
+	p.search.Reset()
+	p.cursor = 0
+	p.filter()
+	return p.search.Focus()
+}
+
+func (p *emoticonPicker) hide() {
+	p.open = false
+	p.search.Blur()
+}
+
+// update 处理选择框打开时的按键，选中表情时返回它
+func (p *emoticonPicker) update(msg tea.KeyMsg) (selected *api.Emoticon, cmd tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+e":
+		p.hide()
+	case "up", "ctrl+p":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down", "ctrl+n":
+		if p.cursor < len(p.matched)-1 {
+			p.cursor++
+		}
+	case "enter":
+		if p.cursor < len(p.matched) {
+			emoticon := p.matched[p.cursor].emoticon
+			selected = &emoticon
+			p.hide()
+		}
+	default:
+		p.search, cmd = p.search.Update(msg)
+		p.filter()
+	}
+	return
+}
+
+func (p *emoticonPicker) view(width, height int) string {
+	rows := []string{p.search.View(), ""}
+	switch {
+	case !p.loaded:
+		rows = append(rows, "正在加载表情...")
+	case len(p.matched) == 0:
+		rows = append(rows, "没有找到表情")
+	default:
+		// 光标所在的那一页
+		start := p.cursor / emoticonPickerRows * emoticonPickerRows
+		end := min(start+emoticonPickerRows, len(p.matched))
+		for i := start; i < end; i++ {
+			item := p.matched[i]
+			row := fmt.Sprintf("%s %s", item.emoticon.Emoji, urlStyle(item.pkgName))
+			rows = append(rows, selectableRow(row, i == p.cursor))
+		}
+		rows = append(rows, "", fmt.Sprintf("%d/%d 上下选择 回车发送 esc关闭", p.cursor+1, len(p.matched)))
+	}
+	ui := lipgloss.NewStyle().Width(40).Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+	return overlayView(ui, width, height)
+}
@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+)
+
+// giftPanelRows 礼物面板一页显示几个礼物
+const giftPanelRows = 8
+
+type giftLoaded struct {
+	gifts  []api.GiftConfig
+	bag    []api.BagGift
+	wallet api.Wallet
+	err    error
+}
+
+type giftSent struct {
+	name string
+	num  int
+	err  error
+}
+
+// giftPanel 礼物面板，tab切换礼物和包裹，上下选择，左右调整数量，付费礼物赠送前需要确认
+type giftPanel struct {
+	open       bool
+	loaded     bool
+	showBag    bool
+	gifts      []api.GiftConfig
+	bag        []api.BagGift
+	wallet     api.Wallet
+	cursor     int
+	num        int
+	confirming bool
+	confirmYes bool
+}
+
+func loadGifts(room *api.LiveRoom) tea.Cmd {
+	return func() tea.Msg {
+		ctx := room.Context()
+		config, err := live_room.GetGiftConfig(ctx, room.Client, room.RoomID)
+		if err != nil {
+			return &giftLoaded{err: err}
+		}
+		bag, err := live_room.GetBagList(ctx, room.Client, room.RoomID)
+		if err != nil {
+			return &giftLoaded{err: err}
+		}
+		wallet, err := live_room.GetWallet(ctx, room.Client)
+		if err != nil {
+			return &giftLoaded{err: err}
+		}
+		var items []api.BagGift
+		for _, item := range bag.Data.List {
+			if item.GiftNum > 0 {
+				items = append(items, item)
+			}
+		}
+		return &giftLoaded{gifts: config.Data.List, bag: items, wallet: wallet.Data}
+	}
+}
+
+func (p *giftPanel) setGifts(msg *giftLoaded) {
+	p.gifts, p.bag, p.wallet = msg.gifts, msg.bag, msg.wallet
+	p.loaded = true
+	p.cursor = min(p.cursor, max(0, p.len()-1))
+	p.num = 1
+	// 列表换了，确认框里的礼物和数量可能已经不对，取消这次确认
+	p.confirming = false
+}
+
+func (p *giftPanel) show() {
+	p.open = true
+	p.confirming = false
+	p.num = 1
+}
+
+func (p *giftPanel) hide() {
+	p.open = false
+	p.confirming = false
+}
+
+func (p *giftPanel) len() int {
+	if p.showBag {
+		return len(p.bag)
+	}
+	return len(p.gifts)
+}
+
+// maxNum 包裹里的礼物最多送完
+func (p *giftPanel) maxNum() int {
+	if p.showBag && p.cursor < len(p.bag) {
+		return p.bag[p.cursor].GiftNum
+	}
+	return 9999
+}
+
+// paid 当前选中的是要花电池的礼物
+func (p *giftPanel) paid() bool {
+	return !p.showBag && p.cursor < len(p.gifts) && p.gifts[p.cursor].CoinType == api.CoinTypeGold
+}
+
+// update 处理面板打开时的按键，需要赠送时返回对应的命令
+func (p *giftPanel) update(msg tea.KeyMsg, room *api.LiveRoom) (cmd tea.Cmd) {
+	if p.confirming {
+		switch msg.String() {
+		case "left", "right":
+			p.confirmYes = !p.confirmYes
+		case "enter", " ":
+			p.confirming = false
+			if p.confirmYes {
+				return p.send(room)
+			}
+		case "esc":
+			p.confirming = false
+		}
+		return
+	}
+	switch msg.String() {
+	case "esc", "ctrl+g":
+		p.hide()
+	case "tab":
+		p.showBag = !p.showBag
+		p.cursor, p.num = 0, 1
+	case "up", "k":
+		if p.cursor > 0 {
+			p.cursor--
+			p.num = 1
+		}
+	case "down", "j":
+		if p.cursor < p.len()-1 {
+			p.cursor++
+			p.num = 1
+		}
+	case "left", "h", "-":
+		p.num = max(1, p.num-1)
+	case "right", "l", "+", "=":
+		p.num = min(p.maxNum(), p.num+1)
+	case "enter":
+		if !p.loaded || p.cursor >= p.len() {
+			break
+		}
+		if p.paid() {
+			p.confirming = true
+			p.confirmYes = false
+			break
+		}
+		return p.send(room)
+	}
+	return
+}
+
+func (p *giftPanel) send(room *api.LiveRoom) tea.Cmd {
+	if p.cursor >= p.len() {
+		return nil
+	}
+	num := p.num
+	p.hide()
+	// 送出后余额和包裹都变了，下次打开时重新加载
+	p.loaded = false
+	if p.showBag {
+		item := p.bag[p.cursor]
+		return func() tea.Msg {
+			err := live_room.SendBagGift(room.Context(), room, &item, num)
+			return &giftSent{name: item.GiftName, num: num, err: err}
+		}
+	}
+	gift := p.gifts[p.cursor]
+	return func() tea.Msg {
+		err := live_room.SendGift(room.Context(), room, &gift, num)
+		return &giftSent{name: gift.Name, num: num, err: err}
+	}
+}
+
+func giftPrice(gift api.GiftConfig, num int) string {
+	total := gift.Price * int64(num)
+	if gift.CoinType == api.CoinTypeGold {
+		return fmt.Sprintf("%.1f电池", float64(total)/100)
+	}
+	return fmt.Sprintf("%d银瓜子", total)
+}
+
+func (p *giftPanel) view(width, height int) string {
+	if p.confirming && p.cursor < len(p.gifts) {
+		gift := p.gifts[p.cursor]
+		question := fmt.Sprintf("确定赠送%s x%d，共%s吗？", gift.Name, p.num, giftPrice(gift, p.num))
+		return confirmView(question, "赠送", p.confirmYes, width, height)
+	}
+	return overlayView(p.listView(), width, height)
+}
+
+func (p *giftPanel) listView() string {
+	giftTab, bagTab := activeTab.Render("礼物"), tab.Render("包裹")
+	if p.showBag {
+		giftTab, bagTab = tab.Render("礼物"), activeTab.Render("包裹")
+	}
+	rows := []string{lipgloss.JoinHorizontal(lipgloss.Bottom, giftTab, bagTab)}
+	switch {
+	case !p.loaded:
+		rows = append(rows, "正在加载礼物...")
+	case p.len() == 0:
+		rows = append(rows, "什么也没有")
+	default:
+		rows = append(rows, fmt.Sprintf("电池 %.1f  银瓜子 %d", float64(p.wallet.Gold)/100, p.wallet.Silver), "")
+		start := p.cursor / giftPanelRows * giftPanelRows
+		end := min(start+giftPanelRows, p.len())
+		for i := start; i < end; i++ {
+			var row string
+			if p.showBag {
+				item := p.bag[i]
+				row = fmt.Sprintf("%s x%d", item.GiftName, item.GiftNum)
+				if item.ExpireAt > 0 {
+					row += " " + urlStyle(time.Unix(item.ExpireAt, 0).Format("01-02过期"))
+				}
+			} else {
+				gift := p.gifts[i]
+				row = fmt.Sprintf("%s %s", gift.Name, urlStyle(giftPrice(gift, 1)))
+			}
+			if i == p.cursor {
+				row = fmt.Sprintf("%s  数量 %d", row, p.num)
+			}
+			rows = append(rows, selectableRow(row, i == p.cursor))
+		}
+		rows = append(rows, "", "上下选择 左右调整数量 回车赠送 tab切换 esc关闭")
+	}
+	return lipgloss.NewStyle().Width(48).Padding(0, 2).Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
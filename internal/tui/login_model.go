@@ -1,12 +1,12 @@
 package tui
 
 import (
+	"context"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/shr-go/bili_live_tui/api"
 	"github.com/shr-go/bili_live_tui/internal/live_room"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
-	"net/http"
 	"os"
 	"time"
 )
@@ -22,8 +22,9 @@ const (
 )
 
 type loginModel struct {
+	ctx         context.Context
 	step        loginStep
-	client      *http.Client
+	client      *api.Client
 	loginData   *api.QRCodeLoginData
 	room        *api.LiveRoom
 	cookies     string
@@ -32,8 +33,9 @@ type loginModel struct {
 	quit        bool
 }
 
-func newLoginModel(client *http.Client) loginModel {
+func newLoginModel(ctx context.Context, client *api.Client) loginModel {
 	return loginModel{
+		ctx:         ctx,
 		step:        loginStepConfirmLogin,
 		client:      client,
 		loginData:   nil,
@@ -50,7 +52,7 @@ type waitScanMsg struct{}
 type TickMsg time.Time
 
 func (m *loginModel) loadLoginData() tea.Msg {
-	loginData, err := live_room.QRCodeLogin(m.client)
+	loginData, err := live_room.QRCodeLogin(m.ctx, m.client)
 	if err != nil {
 		logging.Fatalf("loadLoginData failed, err=%v", err)
 	}
@@ -65,7 +67,7 @@ func tickEvery() tea.Cmd {
 }
 
 func (m *loginModel) pollLoginStatus() tea.Msg {
-	cookies, err := live_room.PollLogin(m.client, m.loginData)
+	cookies, err := live_room.PollLogin(m.ctx, m.client, m.loginData)
 	if err != nil {
 		logging.Fatalf("pollLoginStatus failed, err=%v", err)
 	}
@@ -81,13 +83,13 @@ func (m *loginModel) pollLoginStatus() tea.Msg {
 
 func (m *loginModel) enterRoom() tea.Msg {
 	if m.chooseLogin && !m.localCookie {
-		if !live_room.CheckCookieValid(m.client, m.cookies) {
+		if !live_room.CheckCookieValid(m.ctx, m.client, m.cookies) {
 			logging.Fatalf("PrepareEnterRoom cookies check failed, program exit")
 		}
-		os.WriteFile("COOKIE.DAT", []byte(m.cookies), 0o660)
+		os.WriteFile(cookieFile, []byte(m.cookies), 0o660)
 	}
 
-	if room, err := live_room.AuthAndConnect(m.client, LiveConfig.RoomID); err != nil {
+	if room, err := live_room.AuthAndConnect(m.ctx, m.client, &LiveConfig); err != nil {
 		logging.Fatalf("AuthAndConnect failed, err=%v", err)
 	} else {
 		m.room = room
@@ -2,9 +2,7 @@ package tui
 
 import (
 	"container/list"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"runtime"
 	"strings"
@@ -15,6 +13,8 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+	"github.com/shr-go/bili_live_tui/internal/record"
 	"github.com/shr-go/bili_live_tui/pkg/logging"
 	"golang.org/x/term"
 )
@@ -28,6 +28,29 @@ const (
 	inputView
 )
 
+const (
+	defaultPrompt = "> "
+	// defaultDanmuLength 未登录或者接口没有返回长度限制时使用
+	defaultDanmuLength = 20
+	// maxSplitParts 开启拆分时一次最多拆成几条
+	maxSplitParts = 5
+	// likeBatchDelay 第一次点赞后等这么久，期间的点赞合并成一次上报
+	likeBatchDelay = time.Second
+)
+
+type likeFlush struct{}
+
+type likeSent struct {
+	count int
+	err   error
+}
+
+// likeLoaded 进入房间时获取的点赞总数
+type likeLoaded struct {
+	count int64
+	err   error
+}
+
 type medalInfo struct {
 	level      uint8
 	shipLevel  uint8
@@ -37,12 +60,15 @@ type medalInfo struct {
 
 type danmuMsg struct {
 	uid          uint64
+	dmID         string
 	uName        string
 	chatTime     time.Time
 	content      string
 	medal        *medalInfo
 	nameColor    string
 	contentColor string
+	// replyUName 这条弹幕回复的用户
+	replyUName string
 }
 
 type model struct {
@@ -53,52 +79,137 @@ type model struct {
 	ready      bool
 	lockBottom bool
 	state      sessionState
+	player     *record.Player
+	status     *api.ConnStatus
+	sender     *live_room.Sender
+	// danmuLength 当前账号单条弹幕的长度限制
+	danmuLength int
+	// retry 上一条发送失败的弹幕，按ctrl+r重新发送
+	retry  *sendResult
+	picker emoticonPicker
+	gifts  giftPanel
+	mute   muteDialog
+	admin  adminPanel
+	// selected 选择模式下选中的弹幕，replyTo为正在回复的弹幕
+	selected *list.Element
+	replyTo  *danmuMsg
+	width    int
+	height   int
+	// likePending 还没上报的点赞次数，likeCount为房间的点赞总数，-1表示还不知道
+	likePending int
+	likeCount   int64
+	// apiStats 所有接口的限速统计，被限速或拒绝过时显示在状态栏
+	apiStats api.LimiterStats
 }
 
 func InitialModel(room *api.LiveRoom) model {
+	danmuLength := defaultDanmuLength
+	if room.RoomUserInfo != nil && room.RoomUserInfo.Danmu.Length > 0 {
+		danmuLength = room.RoomUserInfo.Danmu.Length
+	}
 	ti := textinput.New()
-	ti.CharLimit = 20
+	ti.CharLimit = danmuLength
+	if LiveConfig.SplitLongDanmu {
+		ti.CharLimit = danmuLength * maxSplitParts
+	}
+	var sender *live_room.Sender
+	if room.Client != nil {
+		sender = live_room.NewSender(room.Client)
+	}
 
 	return model{
-		danmu:      list.New(),
-		room:       room,
-		viewport:   viewport.Model{},
-		textInput:  ti,
-		ready:      false,
-		lockBottom: true,
-		state:      contentView,
+		danmu:       list.New(),
+		room:        room,
+		viewport:    viewport.Model{},
+		textInput:   ti,
+		ready:       false,
+		lockBottom:  true,
+		state:       contentView,
+		sender:      sender,
+		danmuLength: danmuLength,
+		picker:      newEmoticonPicker(),
+		admin:       newAdminPanel(),
+		likeCount:   -1,
 	}
 }
 
-func (m model) sendDanmu(needSend string) tea.Cmd {
+// InitialReplayModel 回放模式，单步回放时在弹幕区域按n放出下一条
+func InitialReplayModel(room *api.LiveRoom, player *record.Player) model {
+	m := InitialModel(room)
+	m.player = player
+	return m
+}
+
+func (m model) sendDanmu(needSend string, reply *danmuMsg) tea.Cmd {
 	if m.room.RoomUserInfo == nil {
 		danmu := generateFakeDanmuMsg(needSend)
 		return func() tea.Msg {
 			return danmu
 		}
 	} else {
-		danmu := generateDanmuMsg(needSend, m.room)
+		// 超长的弹幕拆开后按服务器要求的间隔依次发送，中途失败时剩下的部分留着重试
+		parts := live_room.SplitDanmu(needSend, m.danmuLength)
 		return func() tea.Msg {
-			contentType, form := packDanmuMsgForm(danmu)
-			baseURL := "https://api.live.bilibili.com/msg/send"
-			resp, err := m.room.Client.Post(baseURL, contentType, form)
-			if err != nil {
-				logging.Errorf("Send Danmu failed, err=%v", err)
-				return nil
-			}
-			defer resp.Body.Close()
-			respBody, err := ioutil.ReadAll(resp.Body)
-			var data map[string]interface{}
-			if err = json.Unmarshal(respBody, &data); err != nil || data["code"].(float64) != 0 {
-				logging.Errorf("Send Danmu failed, err=%v, data=%v", err, data)
-				return nil
+			for i, part := range parts {
+				danmu := generateDanmuMsg(part, m.room)
+				// 拆开的弹幕只有第一条带上回复
+				if reply != nil && i == 0 {
+					danmu.ReplyMid, danmu.ReplyDmid = reply.uid, reply.dmID
+				}
+				contentType, form := packDanmuMsgForm(danmu)
+				if err := m.sender.Send(m.room.Context(), contentType, form); err != nil {
+					logging.Errorf("Send Danmu failed, err=%v", err)
+					if i > 0 {
+						reply = nil
+					}
+					return &sendResult{content: strings.Join(parts[i:], ""), reply: reply, err: err}
+				}
 			}
-			return nil
+			return &sendResult{content: needSend}
+		}
+	}
+}
+
+func (m model) sendEmoticon(emoticon *api.Emoticon) tea.Cmd {
+	danmu := generateEmoticonMsg(emoticon, m.room)
+	return func() tea.Msg {
+		contentType, form := packDanmuMsgForm(danmu)
+		err := m.sender.Send(m.room.Context(), contentType, form)
+		if err != nil {
+			logging.Errorf("Send emoticon failed, err=%v", err)
+		}
+		return &sendResult{content: emoticon.Emoji, emoticon: emoticon, err: err}
+	}
+}
+
+// flushLikes 上报攒下的点赞
+func (m *model) flushLikes() tea.Cmd {
+	count := m.likePending
+	if count == 0 {
+		return nil
+	}
+	m.likePending = 0
+	room := m.room
+	return func() tea.Msg {
+		err := live_room.SendLike(room.Context(), room, count)
+		if err != nil {
+			logging.Errorf("send like failed, err=%v", err)
 		}
+		return &likeSent{count: count, err: err}
+	}
+}
+
+func loadLikeCount(room *api.LiveRoom) tea.Cmd {
+	return func() tea.Msg {
+		count, err := live_room.GetLikeCount(room.Context(), room.Client, room.RoomID)
+		return &likeLoaded{count: count, err: err}
 	}
 }
 
 func (m model) Init() tea.Cmd {
+	if m.room.Client != nil {
+		return tea.Batch(tickAPIStats(), loadLikeCount(m.room))
+	}
 	return nil
 }
 
@@ -109,9 +220,40 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	)
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.mute.target != nil && msg.String() != "ctrl+c" {
+			return m, m.mute.update(msg, m.room)
+		}
+		if m.admin.open && msg.String() != "ctrl+c" {
+			return m, m.admin.update(msg, m.room)
+		}
+		if m.gifts.open && msg.String() != "ctrl+c" {
+			return m, m.gifts.update(msg, m.room)
+		}
+		// 表情选择框打开时按键都交给它
+		if m.picker.open && msg.String() != "ctrl+c" {
+			selected, cmd := m.picker.update(msg)
+			if selected != nil {
+				cmd = tea.Batch(cmd, m.sendEmoticon(selected))
+			}
+			return m, cmd
+		}
+		if m.state == contentView {
+			if handled, cmd := m.updateSelection(msg); handled {
+				return m, cmd
+			}
+		}
 		switch msg.String() {
 		case "ctrl+c":
 			return m, tea.Quit
+		case "ctrl+e":
+			if m.room.RoomUserInfo == nil {
+				m.pushDanmu(generateSystemMsg("登录后才能发送表情"))
+				break
+			}
+			cmds = append(cmds, m.picker.show())
+			if !m.picker.loaded {
+				cmds = append(cmds, loadEmoticons(m.room))
+			}
 		case "tab":
 			if m.state == contentView {
 				m.state = inputView
@@ -121,19 +263,67 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.state = contentView
 				m.textInput.Blur()
 			}
+		case "ctrl+g":
+			if m.room.RoomUserInfo == nil {
+				m.pushDanmu(generateSystemMsg("登录后才能赠送礼物"))
+				break
+			}
+			m.gifts.show()
+			if !m.gifts.loaded {
+				cmds = append(cmds, loadGifts(m.room))
+			}
+		case "ctrl+b":
+			if !live_room.CanModerate(m.room) {
+				m.pushDanmu(generateSystemMsg("只有房管和主播可以管理房间"))
+				break
+			}
+			m.admin.show()
+			cmds = append(cmds, loadAdmin(m.room))
+		case "ctrl+l":
+			if m.room.RoomUserInfo == nil {
+				m.pushDanmu(generateSystemMsg("登录后才能点赞"))
+				break
+			}
+			m.likePending++
+			if m.likePending >= live_room.MaxLikeBatch {
+				cmds = append(cmds, m.flushLikes())
+			} else if m.likePending == 1 {
+				cmds = append(cmds, tea.Tick(likeBatchDelay, func(time.Time) tea.Msg {
+					return likeFlush{}
+				}))
+			}
+		case "ctrl+r":
+			if retry := m.retry; retry != nil {
+				m.retry = nil
+				if retry.emoticon != nil {
+					cmds = append(cmds, m.sendEmoticon(retry.emoticon))
+				} else {
+					cmds = append(cmds, m.sendDanmu(retry.content, retry.reply))
+				}
+			}
+		case "n":
+			if m.state == contentView && m.player != nil && m.player.StepMode() {
+				m.player.Step()
+			}
 		case "enter":
 			if m.state == inputView {
 				needSend := m.textInput.Value()
 				m.textInput.Reset()
 				if len(needSend) > 0 {
-					cmd = m.sendDanmu(needSend)
+					cmd = m.sendDanmu(needSend, m.replyTo)
 					cmds = append(cmds, cmd)
+					m.setReply(nil)
 				}
 			}
+		case "esc":
+			if m.state == inputView && m.replyTo != nil {
+				m.setReply(nil)
+			}
 		}
 	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
 		headerHeight := lipgloss.Height(m.headerView()) + focusMarginHeight
-		footerHeight := lipgloss.Height(m.footerView()) + lipgloss.Height(m.textInput.View()) + 3*focusMarginHeight
+		footerHeight := lipgloss.Height(m.footerView()) + lipgloss.Height(m.textInput.View()) + lipgloss.Height(m.statusBarView()) + 3*focusMarginHeight
 		verticalMarginHeight := headerHeight + footerHeight
 		verticalMarginWidth := 2 * focusMarginWidth
 
@@ -150,14 +340,73 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		textWieth := msg.Width - verticalMarginWidth - 3
 		m.textInput.Placeholder = lipgloss.NewStyle().Width(textWieth).Render("Press Enter to Send")
 		m.textInput.Width = textWieth
-	case *danmuMsg:
-		m.danmu.PushBack(msg)
-		for m.danmu.Len() > LiveConfig.ChatBuffer {
-			m.danmu.Remove(m.danmu.Front())
+	case *api.ConnStatus:
+		// 心跳回复之外的状态不带延迟，沿用上一次的
+		if msg.RTT == 0 && m.status != nil && msg.State == api.ConnConnected && msg.Host == m.status.Host {
+			msg.RTT = m.status.RTT
 		}
-		if m.ready {
-			m.viewport.SetContent(m.renderDanmu())
+		m.status = msg
+	case *sendResult:
+		if msg.err == nil {
+			break
+		}
+		m.retry = msg
+		m.pushDanmu(generateSendFailedMsg(msg))
+	case *emoticonLoaded:
+		if msg.err != nil {
+			m.picker.hide()
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("获取表情失败: %v", msg.err)))
+			break
+		}
+		m.picker.setItems(msg.items)
+	case *giftLoaded:
+		if msg.err != nil {
+			m.gifts.hide()
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("获取礼物失败: %v", msg.err)))
+			break
+		}
+		m.gifts.setGifts(msg)
+	case *adminLoaded:
+		if msg.err != nil {
+			m.admin.hide()
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("获取禁言列表和屏蔽词失败: %s", apiErrText(msg.err))))
+			break
+		}
+		m.admin.setData(msg)
+	case *adminDone:
+		if msg.err != nil {
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("操作失败: %s", apiErrText(msg.err))))
+		} else {
+			m.pushDanmu(generateSystemMsg(msg.text))
+		}
+		if m.admin.open {
+			cmds = append(cmds, loadAdmin(m.room))
+		}
+	case apiStatsTick:
+		m.apiStats = apiStats(m.room.Client, m.apiStats)
+		cmds = append(cmds, tickAPIStats())
+	case likeFlush:
+		cmds = append(cmds, m.flushLikes())
+	case *likeSent:
+		if msg.err != nil {
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("点赞失败: %s", apiErrText(msg.err))))
+		}
+	case *likeLoaded:
+		if msg.err != nil {
+			logging.Warnf("get like count failed, err=%v", msg.err)
+			break
 		}
+		// 推送可能比接口先到，保留较大的那个
+		m.likeCount = max(m.likeCount, msg.count)
+	case *api.LikeInfoUpdateEvent:
+		m.likeCount = msg.ClickCount
+	case *giftSent:
+		// 成功时等SEND_GIFT推回来再显示
+		if msg.err != nil {
+			m.pushDanmu(generateSystemMsg(fmt.Sprintf("赠送%s x%d失败: %s", msg.name, msg.num, apiErrText(msg.err))))
+		}
+	case *danmuMsg:
+		m.pushDanmu(msg)
 	}
 
 	if m.lockBottom {
@@ -184,34 +433,100 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m *model) pushDanmu(danmu *danmuMsg) {
+	m.danmu.PushBack(danmu)
+	for m.danmu.Len() > LiveConfig.ChatBuffer {
+		front := m.danmu.Front()
+		if front == m.selected {
+			m.selected = front.Next()
+		}
+		m.danmu.Remove(front)
+	}
+	m.refreshDanmu()
+}
+
 func (m model) View() string {
 	if !m.ready {
 		return "\nInitializing..."
 	}
+	if m.picker.open {
+		return m.picker.view(m.width, m.height)
+	}
+	if m.gifts.open {
+		return m.gifts.view(m.width, m.height)
+	}
+	if m.mute.target != nil {
+		return m.mute.view(m.width, m.height)
+	}
+	if m.admin.open {
+		return m.admin.view(m.width, m.height)
+	}
 	var s string
 	contentStr := fmt.Sprintf("%s\n%s\n%s", m.headerView(), m.viewport.View(), m.footerView())
 	textStr := m.textInput.View()
 	if m.state == contentView {
-		s = lipgloss.JoinVertical(lipgloss.Left, focusedStyle.Render(contentStr), unFocusedStyle.Render(textStr))
+		s = lipgloss.JoinVertical(lipgloss.Left, focusedStyle.Render(contentStr), unFocusedStyle.Render(textStr), m.statusBarView())
 	} else {
-		s = lipgloss.JoinVertical(lipgloss.Left, unFocusedStyle.Render(contentStr), focusedStyle.Render(textStr))
+		s = lipgloss.JoinVertical(lipgloss.Left, unFocusedStyle.Render(contentStr), focusedStyle.Render(textStr), m.statusBarView())
 	}
 	return s
 }
 
+func sendConnStatus(program *tea.Program, status *api.ConnStatus) {
+	program.Send(status)
+	if danmu := processConnStatus(status); danmu != nil {
+		program.Send(danmu)
+	}
+}
+
+func drainConnStatus(program *tea.Program, room *api.LiveRoom) {
+	for {
+		select {
+		case status := <-room.StatusChan:
+			sendConnStatus(program, status)
+		default:
+			return
+		}
+	}
+}
+
 func ReceiveMsg(program *tea.Program, room *api.LiveRoom) {
-	for msg := range room.MessageChan {
-		switch msg.Cmd {
-		case "DANMU_MSG": // 普通弹幕消息
-			if danmu := processDanmuMsg(msg); danmu != nil {
-				program.Send(danmu)
+	// 界面订阅全部消息，缓冲满时阻塞，保证弹幕不丢
+	sub := live_room.Subscribe(room, live_room.SubscribeOption{Buffer: 100, Policy: live_room.OverflowBlock})
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case status := <-room.StatusChan:
+			sendConnStatus(program, status)
+		case msg, ok := <-sub.C:
+			if !ok {
+				// 放弃重连的状态在房间关闭前才发出，退出前把剩下的状态都显示出来
+				drainConnStatus(program, room)
+				return
 			}
-		case "INTERACT_WORD": // 普通进场消息
+			event, err := live_room.DecodeEvent(msg)
+			if err != nil {
+				logging.Warnf("decode event failed, err=%v, raw=%s", err, msg.Raw)
+				continue
+			}
+			switch event := event.(type) {
+			case *api.DanmuMsgEvent: // 普通弹幕消息
+				program.Send(processDanmuMsg(event))
+			case *api.SendGiftEvent: // 礼物，自己送的总是显示
+				if event.UID == room.UID || LiveConfig.ShowGift {
+					program.Send(processGiftMsg(event))
+				}
+			case *api.LikeInfoUpdateEvent: // 点赞数，显示在标题旁边
+				program.Send(event)
+			case *api.RoomBlockMsgEvent: // 有人被禁言
+				program.Send(generateSystemMsg(fmt.Sprintf("%s 被禁言了", event.UName)))
+			case *api.InteractWordEvent: // 普通进场消息
 
-		case "ENTRY_EFFECT": // 特效进场消息 和上面的普通进场消息存在其一
+			case *api.EntryEffectEvent: // 特效进场消息 和上面的普通进场消息存在其一
 
-		case "PREPARING": // 直播结束，这里断一下日志
-			logging.Rotate()
+			case *api.PreparingEvent: // 直播结束，这里断一下日志
+				logging.Rotate()
+			}
 		}
 	}
 }
@@ -261,6 +576,10 @@ func (m model) headerView() string {
 		}
 	}
 
+	if m.likeCount >= 0 {
+		header = fmt.Sprintf("%s 👍%d", header, m.likeCount)
+	}
+
 	title := lipgloss.NewStyle().BorderStyle(b).Padding(0, 1).
 		Render(header)
 	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(title)))
@@ -268,7 +587,13 @@ func (m model) headerView() string {
 }
 
 func (m model) footerView() string {
-	info := lipgloss.NewStyle().Render(fmt.Sprintf("%3.f%%", m.viewport.ScrollPercent()*100))
+	footer := fmt.Sprintf("%3.f%%", m.viewport.ScrollPercent()*100)
+	if m.room.Queue != nil {
+		if dropped := m.room.Queue.Dropped(); dropped > 0 {
+			footer = fmt.Sprintf("丢弃%d条 %s", dropped, footer)
+		}
+	}
+	info := lipgloss.NewStyle().Render(footer)
 	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(info)))
 	return lipgloss.JoinHorizontal(lipgloss.Center, line, info)
 }
@@ -282,12 +607,64 @@ func (m model) renderDanmu() string {
 	for danmuElem := m.danmu.Front(); danmuElem != nil; danmuElem = danmuElem.Next() {
 		danmu, ok := danmuElem.Value.(*danmuMsg)
 		if ok {
+			var line string
 			if danmu.medal != nil {
-				sb.WriteString(medalStyle(danmu.medal))
+				line = medalStyle(danmu.medal)
+			}
+			content := danmu.content
+			if danmu.replyUName != "" {
+				content = "@" + danmu.replyUName + " " + content
 			}
-			sb.WriteString(fmt.Sprintln(nameStyle(danmu.uName, danmu.nameColor),
-				contentStyle(danmu.content, danmu.contentColor)))
+			line += fmt.Sprint(nameStyle(danmu.uName, danmu.nameColor), " ", contentStyle(content, danmu.contentColor))
+			if danmuElem == m.selected {
+				line = selectedStyle.Render(line)
+			}
+			sb.WriteString(line)
+			sb.WriteRune('\n')
 		}
 	}
 	return sb.String()
 }
+
+// statusBarView 底部状态栏，显示弹幕连接状态、服务器和心跳延迟
+func (m model) statusBarView() string {
+	width := m.viewport.Width + 2*focusMarginWidth
+	var state, detail string
+	latency := "延迟 --"
+	switch status := m.status; {
+	case m.player != nil:
+		state = "回放"
+	case status == nil:
+		state = api.ConnConnecting.String()
+	default:
+		state = status.State.String()
+		at := status.Time.Format("15:04:05")
+		switch status.State {
+		case api.ConnConnecting:
+			detail = fmt.Sprintf("%s 第%d/%d次", status.Host, status.Attempt, status.MaxAttempt)
+		case api.ConnConnected:
+			detail = status.Host
+			if status.RTT > 0 {
+				latency = fmt.Sprintf("延迟 %dms", status.RTT.Milliseconds())
+			}
+		case api.ConnReconnecting:
+			detail = fmt.Sprintf("%s %.1f秒后第%d/%d次重连", at, status.Delay.Seconds(), status.Attempt, status.MaxAttempt)
+		default:
+			detail = at
+		}
+		if status.Err != nil && status.State != api.ConnConnected {
+			detail = fmt.Sprintf("%s %v", detail, status.Err)
+		}
+	}
+	if limited := m.apiStats.Throttled + m.apiStats.Rejected; limited > 0 {
+		latency = fmt.Sprintf("限速%d次 %s", limited, latency)
+	}
+	stateView := statusStyle.Render(state)
+	latencyView := encodingStyle.Render(latency)
+	detailView := statusText.Copy().
+		Width(max(0, width-lipgloss.Width(stateView)-lipgloss.Width(latencyView))).
+		MaxHeight(1).
+		Render(detail)
+	bar := lipgloss.JoinHorizontal(lipgloss.Top, stateView, detailView, latencyView)
+	return statusBarStyle.Width(width).MaxHeight(1).Render(bar)
+}
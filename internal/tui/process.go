@@ -2,41 +2,52 @@ package tui
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/shr-go/bili_live_tui/api"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+	"github.com/shr-go/bili_live_tui/pkg/logging"
 	"mime/multipart"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func processDanmuMsg(msg *api.DanmuMessage) (danmu *danmuMsg) {
-	defer func() {
-		if r := recover(); r != nil {
-			danmu = nil
-		}
-	}()
-	rawBasicInfo := msg.Info[0].([]interface{})
-	content := msg.Info[1].(string)
-	rawUserInfo := msg.Info[2].([]interface{})
-	rawMedalInfo := msg.Info[3].([]interface{})
-
+func processDanmuMsg(event *api.DanmuMsgEvent) (danmu *danmuMsg) {
 	var medal *medalInfo
-	if len(rawMedalInfo) > 10 {
-		medal = new(medalInfo)
-		medal.level = uint8(rawMedalInfo[0].(float64))
-		medal.shipLevel = uint8(rawMedalInfo[10].(float64))
-		medal.name = rawMedalInfo[1].(string)
-		medal.medalColor = fmt.Sprintf("#%06X", int64(rawMedalInfo[4].(float64)))
+	if event.Medal != nil {
+		medal = &medalInfo{
+			level:      event.Medal.Level,
+			shipLevel:  event.Medal.ShipLevel,
+			name:       event.Medal.Name,
+			medalColor: fmt.Sprintf("#%06X", event.Medal.Color),
+		}
 	}
 	danmu = &danmuMsg{
-		uid:          uint64(rawUserInfo[0].(float64)),
-		uName:        rawUserInfo[1].(string),
-		chatTime:     time.UnixMilli(int64(rawBasicInfo[4].(float64))),
-		content:      content,
+		uid:          event.UID,
+		dmID:         event.DmID,
+		uName:        event.UName,
+		chatTime:     event.SendTime,
+		content:      event.Content,
 		medal:        medal,
-		nameColor:    rawUserInfo[7].(string),
-		contentColor: fmt.Sprintf("#%06X", int64(rawBasicInfo[3].(float64))),
+		nameColor:    event.NameColor,
+		contentColor: fmt.Sprintf("#%06X", event.ContentColor),
+		replyUName:   event.ReplyUName,
+	}
+	return
+}
+
+func processGiftMsg(event *api.SendGiftEvent) (danmu *danmuMsg) {
+	danmu = &danmuMsg{
+		uid:          event.UID,
+		uName:        event.UName,
+		chatTime:     time.Unix(event.Timestamp, 0),
+		content:      fmt.Sprintf("%s %s x%d", event.Action, event.GiftName, event.Num),
+		nameColor:    "#F87299",
+		contentColor: "#FFD700",
 	}
 	return
 }
@@ -54,6 +65,96 @@ func generateFakeDanmuMsg(content string) (danmu *danmuMsg) {
 	return danmu
 }
 
+func generateSystemMsg(content string) (danmu *danmuMsg) {
+	danmu = &danmuMsg{
+		uName:        "【系统】",
+		chatTime:     time.Now(),
+		content:      content,
+		nameColor:    "#FFA500",
+		contentColor: "#FFA500",
+	}
+	return danmu
+}
+
+// sendResult 发送弹幕的结果，成功的弹幕会从弹幕服务器推回来，这里只提示失败
+type sendResult struct {
+	content  string
+	emoticon *api.Emoticon
+	reply    *danmuMsg
+	err      error
+}
+
+// sendErrText 把发送弹幕常见的错误转成提示，未知的错误码直接用服务器的message
+func sendErrText(err error) string {
+	var apiErr *api.APIError
+	switch {
+	case errors.Is(err, live_room.DanmuShieldedErr):
+		return "包含屏蔽词"
+	case errors.Is(err, live_room.DanmuRoomShieldedErr):
+		return "包含房间屏蔽词"
+	case !errors.As(err, &apiErr):
+		return fmt.Sprintf("网络错误: %v", err)
+	}
+	switch apiErr.Code {
+	case api.CodeNotLogin:
+		return "登录已失效，请重新登录"
+	case api.CodeCSRFFailed:
+		return "登录信息校验失败，请重新登录"
+	case api.CodeDanmuMuted:
+		return "你在本房间被禁言了"
+	case api.CodeDanmuTooFast, api.CodeDanmuDuplicate:
+		return "发送太快了，稍后再试"
+	case api.CodeDanmuInvalid:
+		return fmt.Sprintf("弹幕内容不符合要求: %s", apiErr.Message)
+	}
+	if apiErr.Message != "" {
+		return apiErr.Message
+	}
+	return fmt.Sprintf("错误码%d", apiErr.Code)
+}
+
+// apiErrText 接口调用失败的提示，优先用服务器返回的说明
+func apiErrText(err error) string {
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.Message != "" {
+		return apiErr.Message
+	}
+	return sendErrText(err)
+}
+
+func generateSendFailedMsg(result *sendResult) (danmu *danmuMsg) {
+	danmu = &danmuMsg{
+		uName:        "【发送失败】",
+		chatTime:     time.Now(),
+		content:      fmt.Sprintf("%s（%s）按ctrl+r重新发送", result.content, sendErrText(result.err)),
+		nameColor:    "#DC143C",
+		contentColor: "#DC143C",
+	}
+	return danmu
+}
+
+// processConnStatus 断开、重连成功和放弃重连时在弹幕区域提示一下，其余状态只显示在状态栏
+func processConnStatus(status *api.ConnStatus) *danmuMsg {
+	var content string
+	switch status.State {
+	case api.ConnDisconnected:
+		content = "弹幕服务器连接断开"
+	case api.ConnConnected:
+		if status.Attempt == 0 {
+			return nil
+		}
+		content = fmt.Sprintf("弹幕服务器重连成功 (%s)", status.Host)
+	case api.ConnClosed:
+		if status.MaxAttempt == 0 {
+			return nil
+		}
+		content = fmt.Sprintf("弹幕服务器重连%d次均失败，已停止重连", status.MaxAttempt)
+	default:
+		return nil
+	}
+	return generateSystemMsg(content)
+}
+
 func generateDanmuMsg(content string, room *api.LiveRoom) (danmu *api.SendMsgReq) {
 	property := room.RoomUserInfo
 	return &api.SendMsgReq{
@@ -69,13 +170,23 @@ func generateDanmuMsg(content string, room *api.LiveRoom) (danmu *api.SendMsgReq
 	}
 }
 
+// generateEmoticonMsg 表情弹幕的msg是表情的唯一id
+func generateEmoticonMsg(emoticon *api.Emoticon, room *api.LiveRoom) (danmu *api.SendMsgReq) {
+	danmu = generateDanmuMsg(emoticon.EmoticonUnique, room)
+	danmu.DmType = api.DmTypeEmoticon
+	return
+}
+
 func packDanmuMsgForm(danmu *api.SendMsgReq) (contentType string, form *bytes.Buffer) {
 	bodyBuf := &bytes.Buffer{}
 	bodyWriter := multipart.NewWriter(bodyBuf)
 	v := reflect.ValueOf(danmu).Elem()
 	t := reflect.TypeOf(danmu).Elem()
 	for i := 0; i < v.NumField(); i++ {
-		key := t.Field(i).Tag.Get("url")
+		key, opts, _ := strings.Cut(t.Field(i).Tag.Get("url"), ",")
+		if opts == "omitempty" && v.Field(i).IsZero() {
+			continue
+		}
 		vi := v.Field(i).Interface()
 		switch value := vi.(type) {
 		case int:
@@ -93,3 +204,40 @@ func packDanmuMsgForm(danmu *api.SendMsgReq) (contentType string, form *bytes.Bu
 	form = bodyBuf
 	return
 }
+
+// apiStatsInterval 多久检查一次接口的限速统计
+const apiStatsInterval = 30 * time.Second
+
+type apiStatsTick struct{}
+
+func tickAPIStats() tea.Cmd {
+	return tea.Tick(apiStatsInterval, func(time.Time) tea.Msg {
+		return apiStatsTick{}
+	})
+}
+
+// apiStats 汇总所有接口被限速和被服务器拒绝的次数，和上次相比有变化时把每类接口的统计写到日志
+func apiStats(client *api.Client, last api.LimiterStats) (total api.LimiterStats) {
+	stats := client.Stats()
+	families := make([]string, 0, len(stats))
+	for family, s := range stats {
+		families = append(families, family)
+		total.Requests += s.Requests
+		total.Throttled += s.Throttled
+		total.WaitTime += s.WaitTime
+		total.Retries += s.Retries
+		total.Rejected += s.Rejected
+	}
+	if total.Throttled == last.Throttled && total.Rejected == last.Rejected && total.Retries == last.Retries {
+		return
+	}
+	sort.Strings(families)
+	for _, family := range families {
+		s := stats[family]
+		if s.Throttled > 0 || s.Rejected > 0 || s.Retries > 0 {
+			logging.Infof("api stats, family=%s, requests=%d, throttled=%d, wait=%v, retries=%d, rejected=%d",
+				family, s.Requests, s.Throttled, s.WaitTime, s.Retries, s.Rejected)
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"container/list"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/shr-go/bili_live_tui/internal/live_room"
+)
+
+var (
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+
+	replyChipStyle = lipgloss.NewStyle().
+			Foreground(getColor("#FFF7DB")).
+			Background(getColor("#F25D94")).
+			Padding(0, 1).
+			MarginRight(1)
+)
+
+// updateSelection 弹幕区域按v进入选择模式，上下移动选中的弹幕，按r回复，按m禁言，esc退出
+func (m *model) updateSelection(msg tea.KeyMsg) (handled bool, cmd tea.Cmd) {
+	if m.selected == nil {
+		if msg.String() != "v" || m.danmu.Len() == 0 {
+			return false, nil
+		}
+		m.selectElem(m.danmu.Back())
+		return true, nil
+	}
+	switch msg.String() {
+	case "up", "k":
+		if prev := m.selected.Prev(); prev != nil {
+			m.selectElem(prev)
+		}
+	case "down", "j":
+		if next := m.selected.Next(); next != nil {
+			m.selectElem(next)
+		}
+	case "r":
+		danmu := m.selected.Value.(*danmuMsg)
+		// 系统提示和假弹幕没有用户
+		if danmu.uid == 0 || danmu.dmID == "" || m.room.RoomUserInfo == nil {
+			break
+		}
+		m.clearSelection()
+		m.setReply(danmu)
+		m.state = inputView
+		cmd = m.textInput.Focus()
+	case "m":
+		danmu := m.selected.Value.(*danmuMsg)
+		if danmu.uid == 0 {
+			break
+		}
+		if !live_room.CanModerate(m.room) {
+			m.pushDanmu(generateSystemMsg("只有房管和主播可以禁言"))
+			break
+		}
+		if danmu.uid == m.room.UID || danmu.uid == m.room.OwnerId {
+			m.pushDanmu(generateSystemMsg("不能禁言自己或主播"))
+			break
+		}
+		m.clearSelection()
+		m.mute.show(danmu)
+	case "esc", "v":
+		m.clearSelection()
+	case "tab":
+		m.clearSelection()
+		return false, nil
+	case "ctrl+c":
+		return false, nil
+	}
+	return true, cmd
+}
+
+func (m *model) selectElem(elem *list.Element) {
+	m.selected = elem
+	m.lockBottom = false
+	m.refreshDanmu()
+	// 弹幕每条一行，前面用空行补齐到视口高度
+	line := max(0, m.viewport.Height-m.danmu.Len())
+	for e := m.danmu.Front(); e != nil && e != elem; e = e.Next() {
+		line++
+	}
+	if line < m.viewport.YOffset {
+		m.viewport.SetYOffset(line)
+	} else if line >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(line - m.viewport.Height + 1)
+	}
+}
+
+func (m *model) clearSelection() {
+	m.selected = nil
+	m.refreshDanmu()
+}
+
+// setReply 设置回复的弹幕，输入框前面显示@用户名，danmu为nil时取消回复
+func (m *model) setReply(danmu *danmuMsg) {
+	m.replyTo = danmu
+	m.textInput.Prompt = defaultPrompt
+	if danmu != nil {
+		m.textInput.Prompt = replyChipStyle.Render("@"+danmu.uName) + defaultPrompt
+	}
+}
+
+func (m *model) refreshDanmu() {
+	if m.ready {
+		m.viewport.SetContent(m.renderDanmu())
+	}
+}
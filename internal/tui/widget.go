@@ -159,6 +159,8 @@ var (
 				Background(getColor("#F25D94")).
 				Underline(true)
 
+	selectedRowStyle = activeButtonStyle.Copy().Padding(0, 1).MarginTop(0)
+
 	listStyle = lipgloss.NewStyle().
 			Border(lipgloss.NormalBorder(), false, true, false, false).
 			BorderForeground(subtle).
@@ -219,3 +221,32 @@ var (
 	unFocusedStyle = lipgloss.NewStyle().
 			BorderStyle(lipgloss.HiddenBorder())
 )
+
+// overlayView 把对话框放在屏幕中间，表情、礼物和管理面板共用
+func overlayView(ui string, width, height int) string {
+	return lipgloss.Place(width, height,
+		lipgloss.Center, lipgloss.Center,
+		dialogBoxStyle.Render(ui),
+		lipgloss.WithWhitespaceForeground(subtle),
+	)
+}
+
+// selectableRow 列表中的一行，选中时高亮
+func selectableRow(row string, selected bool) string {
+	if selected {
+		return selectedRowStyle.Render(row)
+	}
+	return listItem(row)
+}
+
+// confirmView 确认框，按钮样式和登录时一样，extra显示在问题和按钮之间
+func confirmView(question, yesLabel string, yes bool, width, height int, extra ...string) string {
+	yesButton, noButton := buttonStyle.Render(yesLabel), activeButtonStyle.Render("取消")
+	if yes {
+		yesButton, noButton = activeButtonStyle.Render(yesLabel), buttonStyle.Render("取消")
+	}
+	rows := []string{lipgloss.NewStyle().Width(40).Align(lipgloss.Center).Render(question)}
+	rows = append(rows, extra...)
+	rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, yesButton, "  ", noButton))
+	return overlayView(lipgloss.JoinVertical(lipgloss.Center, rows...), width, height)
+}
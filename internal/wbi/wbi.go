@@ -0,0 +1,89 @@
+// Package wbi web端接口的WBI签名，客户端和模拟服务器共用
+package wbi
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var mixinKeyEncTab = [64]int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35,
+	27, 43, 5, 49, 33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13,
+	37, 48, 7, 16, 24, 55, 40, 61, 26, 17, 0, 1, 60, 51, 30, 4,
+	22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11, 36, 20, 34, 44, 52,
+}
+
+// KeyFromURL nav接口返回的wbi_img里是图片地址，文件名就是key
+func KeyFromURL(u string) string {
+	name := path.Base(u)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// MixinKey 把img_key和sub_key按固定顺序打乱后取前32位
+func MixinKey(imgKey, subKey string) string {
+	raw := imgKey + subKey
+	if len(raw) < len(mixinKeyEncTab) {
+		return ""
+	}
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = raw[mixinKeyEncTab[i]]
+	}
+	return string(key)
+}
+
+// Sign 给参数加上wts和w_rid，返回编码后的query，v不会被修改
+func Sign(v url.Values, mixinKey string, wts int64) string {
+	signed := make(url.Values, len(v)+2)
+	for key, values := range v {
+		if key == "w_rid" {
+			continue
+		}
+		for _, value := range values {
+			signed.Add(key, filterValue(value))
+		}
+	}
+	signed.Set("wts", strconv.FormatInt(wts, 10))
+	query := encode(signed)
+	signed.Set("w_rid", digest(query, mixinKey))
+	return encode(signed)
+}
+
+// Verify 检查query里的w_rid是否和参数一致
+func Verify(v url.Values, mixinKey string) bool {
+	wRid := v.Get("w_rid")
+	if wRid == "" || v.Get("wts") == "" {
+		return false
+	}
+	rest := make(url.Values, len(v))
+	for key, values := range v {
+		if key != "w_rid" {
+			rest[key] = values
+		}
+	}
+	return digest(encode(rest), mixinKey) == wRid
+}
+
+func digest(query, mixinKey string) string {
+	sum := md5.Sum([]byte(query + mixinKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// encode 按key排序，空格编码成%20，和网页端的encodeURIComponent一致
+func encode(v url.Values) string {
+	return strings.ReplaceAll(v.Encode(), "+", "%20")
+}
+
+// filterValue 网页端签名前会去掉值里的!'()*
+func filterValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("!'()*", r) {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,55 @@
+package wbi
+
+import (
+	"net/url"
+	"testing"
+)
+
+const (
+	testImgKey   = "7cd084941338484aae1ad9425b84077c"
+	testSubKey   = "4932caff0ff746eab6f01bf08b70ac45"
+	testMixinKey = "ea1db124af3c7062474693fa704f4ff8"
+)
+
+func TestKeyFromURL(t *testing.T) {
+	got := KeyFromURL("https://i0.hdslb.com/bfs/wbi/" + testImgKey + ".png")
+	if got != testImgKey {
+		t.Errorf("unexpected key %s", got)
+	}
+}
+
+func TestMixinKey(t *testing.T) {
+	if got := MixinKey(testImgKey, testSubKey); got != testMixinKey {
+		t.Errorf("mixin key mismatch, got %s", got)
+	}
+	if got := MixinKey("short", ""); got != "" {
+		t.Errorf("short keys should give empty mixin key, got %s", got)
+	}
+}
+
+func TestSign(t *testing.T) {
+	v := url.Values{"foo": {"114"}, "bar": {"514"}, "zab": {"1919810"}}
+	got := Sign(v, testMixinKey, 1702204169)
+	signed, _ := url.ParseQuery(got)
+	if signed.Get("w_rid") != "8f6f2b5b3d485fe1886cec6a0be8c5d4" || signed.Get("wts") != "1702204169" {
+		t.Errorf("w_rid mismatch, got %s", got)
+	}
+	if !Verify(signed, testMixinKey) {
+		t.Errorf("signed query should verify")
+	}
+	if len(v) != 3 {
+		t.Errorf("Sign should not modify params")
+	}
+
+	// 特殊字符被过滤，空格编码为%20
+	got = Sign(url.Values{"keyword": {"(弹幕) 测试!"}}, testMixinKey, 1702204169)
+	signed, _ = url.ParseQuery(got)
+	if signed.Get("keyword") != "弹幕 测试" || !Verify(signed, testMixinKey) {
+		t.Errorf("unexpected filtered query %s", got)
+	}
+
+	signed.Set("foo", "1")
+	if Verify(signed, testMixinKey) {
+		t.Errorf("tampered query should not verify")
+	}
+}
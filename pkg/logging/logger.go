@@ -80,6 +80,11 @@ func GetDefaultLogger() Logger {
 	return defaultLogger
 }
 
+// SetDefaultLogger 替换默认的logger，测试里没有调用InitLogConfig时使用
+func SetDefaultLogger(logger Logger) {
+	defaultLogger = logger
+}
+
 func LogLevel() string {
 	return defaultLoggingLevel.String()
 }